@@ -0,0 +1,287 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	workerLogView struct {
+		WorkerId  string `json:"worker_id"`
+		BeginTime int64  `json:"begin_time"`
+	}
+
+	// task with progress of synced heights
+	taskView struct {
+		Id              string          `json:"id"`
+		Type            string          `json:"type"`
+		StartHeight     int64           `json:"start_height"`
+		EndHeight       int64           `json:"end_height"`
+		CurrentHeight   int64           `json:"current_height"`
+		SyncedNum       int64           `json:"synced_num"`
+		Progress        float64         `json:"progress,omitempty"` // fraction of synced heights, only for catch up task
+		Status          string          `json:"status"`
+		WorkerId        string          `json:"worker_id"`
+		LastUpdateTime  int64           `json:"last_update_time"`
+		LeaseExpireTime int64           `json:"lease_expire_time"`
+		FencingToken    int64           `json:"fencing_token"`
+		Priority        int             `json:"priority"`
+		WorkerLogs      []workerLogView `json:"worker_logs"`
+	}
+)
+
+func newTaskView(t model.SyncTask) taskView {
+	v := taskView{
+		Id:              t.ID.Hex(),
+		Type:            db.SyncTaskTypeCatchUp,
+		StartHeight:     t.StartHeight,
+		EndHeight:       t.EndHeight,
+		CurrentHeight:   t.CurrentHeight,
+		Status:          t.Status,
+		WorkerId:        t.WorkerId,
+		LastUpdateTime:  t.LastUpdateTime,
+		LeaseExpireTime: t.LeaseExpireTime,
+		FencingToken:    t.FencingToken,
+		Priority:        t.Priority,
+		WorkerLogs:      make([]workerLogView, 0, len(t.WorkerLogs)),
+	}
+	if t.EndHeight == 0 {
+		v.Type = db.SyncTaskTypeFollow
+	}
+	if t.CurrentHeight >= t.StartHeight {
+		v.SyncedNum = t.CurrentHeight - t.StartHeight + 1
+	}
+	if t.Status == db.SyncTaskStatusCompleted && t.EndHeight > 0 {
+		v.SyncedNum = t.EndHeight - t.StartHeight + 1
+	}
+	if t.EndHeight > 0 {
+		v.Progress = float64(v.SyncedNum) / float64(t.EndHeight-t.StartHeight+1)
+	}
+	for _, l := range t.WorkerLogs {
+		v.WorkerLogs = append(v.WorkerLogs, workerLogView{WorkerId: l.WorkerId, BeginTime: l.BeginTime.Unix()})
+	}
+	return v
+}
+
+// GET /tasks?status=&type=&limit=&cursor=
+// tasks ordered by start height and id desc, cursor is position of last task in previous page
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	taskType := q.Get("type")
+	if taskType != "" && taskType != db.SyncTaskTypeCatchUp && taskType != db.SyncTaskTypeFollow {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid type %v", taskType))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var before *model.TaskPosition
+	if v := q.Get("cursor"); v != "" {
+		if before, err = parseTaskCursor(v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	tasks, err := model.SyncTaskModel.ListTasks(q.Get("status"), taskType, before, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	views := make([]taskView, 0, len(tasks))
+	for _, v := range tasks {
+		views = append(views, newTaskView(v))
+	}
+	res := listResponse{Data: views}
+	if len(tasks) == limit {
+		last := tasks[len(tasks)-1]
+		res.Next = formatTaskCursor(model.TaskPosition{StartHeight: last.StartHeight, ID: last.ID})
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+// cursor of tasks is position of last task in page, formatted as startHeight-id
+func formatTaskCursor(p model.TaskPosition) string {
+	return fmt.Sprintf("%v-%v", p.StartHeight, p.ID.Hex())
+}
+
+func parseTaskCursor(cursor string) (*model.TaskPosition, error) {
+	parts := strings.Split(cursor, "-")
+	if len(parts) != 2 || !bson.IsObjectIdHex(parts[1]) {
+		return nil, fmt.Errorf("invalid cursor %v", cursor)
+	}
+	startHeight, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %v", cursor)
+	}
+	return &model.TaskPosition{StartHeight: startHeight, ID: bson.ObjectIdHex(parts[1])}, nil
+}
+
+// GET /tasks/{id}
+// POST /tasks/{id}/release
+// POST /tasks/{id}/split?height=
+// POST /tasks/{id}/invalidate
+// POST /tasks/{id}/priority?priority=
+//
+// actions are applied only if task is unchanged since it's read, last_update_time param
+// can be passed to require task is unchanged since it's listed
+func handleTask(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/")
+	if len(parts) > 2 || !bson.IsObjectIdHex(parts[0]) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid task path %v", r.URL.Path))
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	wantMethod := http.MethodPost
+	if action == "" {
+		wantMethod = http.MethodGet
+	}
+	if r.Method != wantMethod {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+
+	task, err := model.SyncTaskModel.GetTaskById(bson.ObjectIdHex(parts[0]))
+	if err == mgo.ErrNotFound {
+		writeError(w, http.StatusNotFound, fmt.Errorf("task %v not found", parts[0]))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if v := r.URL.Query().Get("last_update_time"); v != "" && v != strconv.FormatInt(task.LastUpdateTime, 10) {
+		writeError(w, http.StatusConflict, fmt.Errorf("task has been updated at %v", task.LastUpdateTime))
+		return
+	}
+
+	switch action {
+	case "":
+		writeJson(w, http.StatusOK, newTaskView(task))
+		return
+	case "release":
+		if task.Status != db.SyncTaskStatusUnderway {
+			writeError(w, http.StatusConflict, fmt.Errorf("only underway task can be released"))
+			return
+		}
+		err = model.SyncTaskModel.ReleaseTask(task)
+	case "invalidate":
+		if task.EndHeight != 0 {
+			writeError(w, http.StatusConflict, fmt.Errorf("only follow task can be invalidated"))
+			return
+		}
+		err = model.SyncTaskModel.InvalidateFollowTask(task)
+	case "split":
+		height, perr := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid height %v", r.URL.Query().Get("height")))
+			return
+		}
+		if task.EndHeight == 0 || task.Status != db.SyncTaskStatusUnHandled {
+			writeError(w, http.StatusConflict, fmt.Errorf("only unhandled catch up task can be split"))
+			return
+		}
+		if err := checkSplitHeight(task, height); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var newTask model.SyncTask
+		if newTask, err = model.SyncTaskModel.SplitTask(r.Context(), task, height); err == nil {
+			logger.Info("task is split by admin", logger.String("taskId", task.ID.Hex()),
+				logger.String("newTaskId", newTask.ID.Hex()), logger.Int64("height", height))
+		}
+	case "priority":
+		priority, perr := strconv.Atoi(r.URL.Query().Get("priority"))
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid priority %v", r.URL.Query().Get("priority")))
+			return
+		}
+		err = model.SyncTaskModel.SetPriority(task, priority)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action %v", action))
+		return
+	}
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+	logger.Info("task is updated by admin", logger.String("taskId", task.ID.Hex()), logger.String("action", action))
+
+	task, err = model.SyncTaskModel.GetTaskById(task.ID)
+	if err != nil {
+		writeDbError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newTaskView(task))
+}
+
+// GET /workers
+func handleWorkers(w http.ResponseWriter, r *http.Request) {
+	control, err := model.WorkersControlModel.Get()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, control)
+}
+
+// POST /workers/pause?reason=
+// workers of all instances stop taking over tasks and syncing heights until resumed
+func handlePauseWorkers(w http.ResponseWriter, r *http.Request) {
+	setWorkersPaused(w, true, r.URL.Query().Get("reason"))
+}
+
+// POST /workers/resume
+func handleResumeWorkers(w http.ResponseWriter, r *http.Request) {
+	setWorkersPaused(w, false, "")
+}
+
+func setWorkersPaused(w http.ResponseWriter, paused bool, reason string) {
+	control, err := model.WorkersControlModel.SetPaused(paused, reason)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("workers control is set by admin", logger.Bool("paused", paused), logger.String("reason", reason))
+	writeJson(w, http.StatusOK, control)
+}
+
+// optimistic update fails with not found or aborted txn if task has been updated since it's read
+func writeDbError(w http.ResponseWriter, err error) {
+	switch {
+	case err == mgo.ErrNotFound, errors.Is(err, txn.ErrAborted):
+		writeError(w, http.StatusConflict, fmt.Errorf("task has been updated, retry after reading it again"))
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// task split at height keeps at least one height which isn't synced, otherwise it's never completed
+func checkSplitHeight(task model.SyncTask, height int64) error {
+	synced := maxInt64(task.StartHeight-1, task.CurrentHeight)
+	if height <= synced || height >= task.EndHeight {
+		return fmt.Errorf("height should be in range (%v,%v)", synced, task.EndHeight)
+	}
+	return nil
+}
+
+func maxInt64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
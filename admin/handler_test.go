@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewTaskView(t *testing.T) {
+	task := model.SyncTask{
+		ID:            bson.NewObjectId(),
+		StartHeight:   101,
+		EndHeight:     200,
+		CurrentHeight: 125,
+		Status:        db.SyncTaskStatusUnderway,
+		WorkerLogs:    []model.WorkerLog{{WorkerId: "w1", BeginTime: time.Unix(1600000000, 0)}},
+	}
+	v := newTaskView(task)
+	if v.Type != db.SyncTaskTypeCatchUp || v.SyncedNum != 25 || v.Progress != 0.25 {
+		t.Fatalf("unexpected view %+v", v)
+	}
+	if len(v.WorkerLogs) != 1 || v.WorkerLogs[0].BeginTime != 1600000000 {
+		t.Fatalf("unexpected worker logs %+v", v.WorkerLogs)
+	}
+
+	task.Status = db.SyncTaskStatusCompleted
+	if v := newTaskView(task); v.Progress != 1 {
+		t.Fatalf("completed task should have progress 1, got %v", v.Progress)
+	}
+	task.EndHeight, task.CurrentHeight = 0, 0
+	if v := newTaskView(task); v.Type != db.SyncTaskTypeFollow || v.SyncedNum != 0 || v.Progress != 0 {
+		t.Fatalf("unexpected follow task view %+v", v)
+	}
+}
+
+func TestRequestsRejectedBeforeDb(t *testing.T) {
+	handler := authorize("secret", newMux())
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/tasks", "", http.StatusUnauthorized},
+		{http.MethodGet, "/tasks", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodPost, "/tasks", "Bearer secret", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/tasks/xyz", "Bearer secret", http.StatusNotFound},
+		{http.MethodGet, "/tasks/" + bson.NewObjectId().Hex() + "/release", "Bearer secret", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/workers/pause", "Bearer secret", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/tasks?type=x", "Bearer secret", http.StatusBadRequest},
+	}
+	for _, v := range tests {
+		req := httptest.NewRequest(v.method, v.path, nil)
+		if v.token != "" {
+			req.Header.Set("Authorization", v.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != v.want {
+			t.Errorf("%v %v: got status %v, want %v", v.method, v.path, w.Code, v.want)
+		}
+	}
+}
+
+func TestCheckSplitHeight(t *testing.T) {
+	task := model.SyncTask{StartHeight: 101, EndHeight: 200}
+	tests := []struct {
+		currentHeight, height int64
+		valid                 bool
+	}{
+		{0, 100, false},
+		{0, 101, true},
+		{0, 199, true},
+		{0, 200, false},
+		{150, 150, false}, // task would end at its current height and never complete
+		{150, 151, true},
+	}
+	for _, v := range tests {
+		task.CurrentHeight = v.currentHeight
+		if err := checkSplitHeight(task, v.height); (err == nil) != v.valid {
+			t.Errorf("split at %v with current height %v: got err %v, want valid %v",
+				v.height, v.currentHeight, err, v.valid)
+		}
+	}
+}
+
+func TestTaskCursor(t *testing.T) {
+	p := model.TaskPosition{StartHeight: 3742170, ID: bson.NewObjectId()}
+	got, err := parseTaskCursor(formatTaskCursor(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != p {
+		t.Fatalf("got %+v, want %+v", *got, p)
+	}
+	for _, v := range []string{"", "100", "a-" + p.ID.Hex(), "100-xyz", "100-" + p.ID.Hex() + "-1"} {
+		if _, err := parseTaskCursor(v); err == nil {
+			t.Errorf("cursor %q should be invalid", v)
+		}
+	}
+}
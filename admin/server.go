@@ -0,0 +1,110 @@
+// admin api to manage sync tasks and workers
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type (
+	// response of list api, next is cursor of next page, it's empty if there is no more data
+	listResponse struct {
+		Data interface{} `json:"data"`
+		Next string      `json:"next,omitempty"`
+	}
+
+	errResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// start admin server if admin port is set, it blocks until server exits
+func Start() {
+	if conf.SvrConf.AdminPort == 0 {
+		return
+	}
+	if conf.SvrConf.AdminToken == "" {
+		logger.Warn("admin api is served without token", logger.String("env", conf.EnvNameAdminToken))
+	}
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%v", conf.SvrConf.AdminPort),
+		Handler:      authorize(conf.SvrConf.AdminToken, newMux()),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	logger.Info("start admin api", logger.Int("port", conf.SvrConf.AdminPort))
+	if err := server.ListenAndServe(); err != nil {
+		logger.Error("admin api exit", logger.String("err", err.Error()))
+	}
+}
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks", method(http.MethodGet, handleTasks))
+	mux.HandleFunc("/tasks/", handleTask)
+	mux.HandleFunc("/workers", method(http.MethodGet, handleWorkers))
+	mux.HandleFunc("/workers/pause", method(http.MethodPost, handlePauseWorkers))
+	mux.HandleFunc("/workers/resume", method(http.MethodPost, handleResumeWorkers))
+	return mux
+}
+
+// requests should carry bearer token if token is set
+func authorize(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func method(m string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("write admin response fail", logger.String("err", err.Error()))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, errResponse{Error: err.Error()})
+}
+
+// parse limit param, default limit is used if it's empty
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 || limit > maxLimit {
+		return 0, fmt.Errorf("limit should be in range [1,%v]", maxLimit)
+	}
+	return limit, nil
+}
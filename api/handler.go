@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"github.com/irisnet/rainbow-sync/feed"
+	"github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GET /txs?addr=&signer=&limit=&cursor=
+// txs which contain address or are signed by signer, ordered by tx id desc
+func handleTxs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	addr, signer := q.Get("addr"), q.Get("signer")
+	if addr == "" && signer == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("addr or signer is required"))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var beforeTxId uint64
+	if v := q.Get("cursor"); v != "" {
+		if beforeTxId, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid cursor %v", v))
+			return
+		}
+	}
+
+	txs, err := model.TxModel.QueryTxsByAddr(addr, signer, beforeTxId, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res := listResponse{Data: newTxsResponse(txs)}
+	if len(txs) == limit {
+		res.Next = strconv.FormatUint(txs[len(txs)-1].TxId, 10)
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+// GET /txs/{hash}
+func handleTx(w http.ResponseWriter, r *http.Request) {
+	hash := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/txs/"))
+	tx, err := model.TxModel.GetTxByHash(hash)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newTxResponse(tx))
+}
+
+// GET /msgs?type=&denom=&limit=&cursor=
+// msgs of type and denom, ordered by height, tx index and msg index desc
+func handleMsgs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	msgType, denom := q.Get("type"), q.Get("denom")
+	if msgType == "" && denom == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("type or denom is required"))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var before *model.MsgPosition
+	if v := q.Get("cursor"); v != "" {
+		if before, err = parseMsgCursor(v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	msgs, err := new(model.TxMsg).QueryMsgsByTypeAndDenom(msgType, denom, before, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res := listResponse{Data: newTxMsgsResponse(msgs)}
+	if len(msgs) == limit {
+		last := msgs[len(msgs)-1]
+		res.Next = formatMsgCursor(model.MsgPosition{Height: last.Height, TxIndex: last.TxIndex, MsgIndex: last.MsgIndex})
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+// GET /blocks/{height}
+func handleBlock(w http.ResponseWriter, r *http.Request) {
+	v := strings.TrimPrefix(r.URL.Path, "/blocks/")
+	height, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || height <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid height %v", v))
+		return
+	}
+	block, err := model.BlockModel.GetBlockByHeight(height)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newBlockResponse(block))
+}
+
+type syncStatus struct {
+	LatestHeight int64          `json:"latest_height"`
+	TaskStatus   map[string]int `json:"task_status"`
+}
+
+// GET /status
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	block, err := model.BlockModel.GetMaxBlockHeight()
+	if err != nil && err != mgo.ErrNotFound {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	counts, err := model.SyncTaskModel.CountByStatus()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, syncStatus{
+		LatestHeight: block.Height,
+		TaskStatus:   counts,
+	})
+}
+
+// GET /feed/msgs?cursor=&from_height=&limit=
+// msgs below committed watermark in order of position, next cursor is always returned to resume from
+func handleFeedMsgs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var fromHeight int64
+	if v := q.Get("from_height"); v != "" {
+		if fromHeight, err = strconv.ParseInt(v, 10, 64); err != nil || fromHeight < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid from_height %v", v))
+			return
+		}
+	}
+	page, err := feed.Read(q.Get("cursor"), fromHeight, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newFeedPageResponse(page))
+}
+
+func writeQueryError(w http.ResponseWriter, err error) {
+	if err == mgo.ErrNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+// cursor of msgs is position of last msg in page, formatted as height-txIndex-msgIndex
+func formatMsgCursor(p model.MsgPosition) string {
+	return fmt.Sprintf("%v-%v-%v", p.Height, p.TxIndex, p.MsgIndex)
+}
+
+func parseMsgCursor(cursor string) (*model.MsgPosition, error) {
+	var p model.MsgPosition
+	parts := strings.Split(cursor, "-")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid cursor %v", cursor)
+	}
+	height, err1 := strconv.ParseInt(parts[0], 10, 64)
+	txIndex, err2 := strconv.ParseUint(parts[1], 10, 32)
+	msgIndex, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, fmt.Errorf("invalid cursor %v", cursor)
+	}
+	p.Height, p.TxIndex, p.MsgIndex = height, uint32(txIndex), msgIndex
+	return &p, nil
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/irisnet/rainbow-sync/model"
+	"github.com/kaifei-bianjie/msg-parser/modules/bank"
+	"github.com/kaifei-bianjie/msg-parser/types"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMsgCursor(t *testing.T) {
+	p := model.MsgPosition{Height: 3742170, TxIndex: 12, MsgIndex: 1}
+	got, err := parseMsgCursor(formatMsgCursor(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != p {
+		t.Fatalf("got %+v, want %+v", *got, p)
+	}
+	for _, v := range []string{"", "1-2", "a-1-2", "1-2-3-4"} {
+		if _, err := parseMsgCursor(v); err == nil {
+			t.Errorf("cursor %q should be invalid", v)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := map[string]int{"": defaultLimit, "1": 1, "100": 100, "0": 0, "101": 0, "x": 0}
+	for v, want := range tests {
+		limit, err := parseLimit(httptest.NewRequest("GET", "/txs?limit="+v, nil))
+		if want == 0 && err == nil {
+			t.Errorf("limit %q should be invalid", v)
+		}
+		if want > 0 && limit != want {
+			t.Errorf("limit %q: got %v, want %v", v, limit, want)
+		}
+	}
+}
+
+func TestTxResponse(t *testing.T) {
+	tx := model.Tx{
+		Height: 3742170,
+		TxHash: "A1",
+		Fee:    &types.Fee{Amount: []types.Coin{{Denom: "uiris", Amount: "1"}}, Gas: 200000},
+		Msgs: []types.TxMsg{{
+			Type: "send",
+			Msg:  &bank.DocMsgSend{FromAddress: "iaa1", ToAddress: "iaa2", Amount: []types.Coin{{Denom: "uiris", Amount: "1"}}},
+		}},
+	}
+	data, err := json.Marshal(newTxResponse(tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"height", "tx_hash", "actual_fee", "tx_index", "tx_id"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("field %v should be in response %s", key, data)
+		}
+	}
+	if fee := got["fee"].(map[string]interface{}); fee["gas"] != float64(200000) {
+		t.Errorf("fee should be snake case, got %v", fee)
+	}
+	msg := got["msgs"].([]interface{})[0].(map[string]interface{})["msg"].(map[string]interface{})
+	if msg["from_address"] != "iaa1" || msg["to_address"] != "iaa2" {
+		t.Errorf("msg should be snake case like doc in db, got %v", msg)
+	}
+}
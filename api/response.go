@@ -0,0 +1,170 @@
+package api
+
+import (
+	"github.com/irisnet/rainbow-sync/feed"
+	"github.com/irisnet/rainbow-sync/model"
+	"github.com/kaifei-bianjie/msg-parser/types"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// responses of api, fields are named in snake case like fields of docs in db
+type (
+	txResponse struct {
+		Time      int64         `json:"time"`
+		Height    int64         `json:"height"`
+		TxHash    string        `json:"tx_hash"`
+		Fee       *feeResponse  `json:"fee"`
+		ActualFee types.Coin    `json:"actual_fee"`
+		Memo      string        `json:"memo"`
+		Status    string        `json:"status"`
+		Log       string        `json:"log"`
+		Types     []string      `json:"types"`
+		Events    []model.Event `json:"events"`
+		Msgs      []msgResponse `json:"msgs"`
+		Signers   []string      `json:"signers"`
+		Addrs     []string      `json:"addrs"`
+		TxIndex   uint32        `json:"tx_index"`
+		TxId      uint64        `json:"tx_id"`
+		Ext       interface{}   `json:"ext"`
+	}
+
+	feeResponse struct {
+		Amount []types.Coin `json:"amount"`
+		Gas    int64        `json:"gas"`
+	}
+
+	msgResponse struct {
+		Type string      `json:"type"`
+		Msg  interface{} `json:"msg"`
+	}
+
+	txMsgResponse struct {
+		Time      int64         `json:"time"`
+		TxFee     types.Coin    `json:"tx_fee"`
+		Height    int64         `json:"height"`
+		TxHash    string        `json:"tx_hash"`
+		Type      string        `json:"type"`
+		MsgIndex  int           `json:"msg_index"`
+		TxIndex   uint32        `json:"tx_index"`
+		TxStatus  string        `json:"tx_status"`
+		TxMemo    string        `json:"tx_memo"`
+		TxLog     string        `json:"tx_log"`
+		GasUsed   int64         `json:"gas_used"`
+		GasWanted int64         `json:"gas_wanted"`
+		Events    []model.Event `json:"events"`
+		Msg       msgResponse   `json:"msg"`
+		Addrs     []string      `json:"addrs"`
+		TxAddrs   []string      `json:"tx_addrs"`
+		Signers   []string      `json:"signers"`
+		TxSigners []string      `json:"tx_signers"`
+		Denoms    []string      `json:"denoms"`
+	}
+
+	blockResponse struct {
+		Height     int64 `json:"height"`
+		CreateTime int64 `json:"create_time"`
+		TxNum      int64 `json:"tx_num"`
+	}
+
+	feedPageResponse struct {
+		Msgs      []txMsgResponse `json:"msgs"`
+		Next      string          `json:"next"`
+		Watermark int64           `json:"watermark"`
+	}
+)
+
+func newTxResponse(tx model.Tx) txResponse {
+	res := txResponse{
+		Time:      tx.Time,
+		Height:    tx.Height,
+		TxHash:    tx.TxHash,
+		ActualFee: tx.ActualFee,
+		Memo:      tx.Memo,
+		Status:    tx.Status,
+		Log:       tx.Log,
+		Types:     tx.Types,
+		Events:    tx.Events,
+		Msgs:      make([]msgResponse, 0, len(tx.Msgs)),
+		Signers:   tx.Signers,
+		Addrs:     tx.Addrs,
+		TxIndex:   tx.TxIndex,
+		TxId:      tx.TxId,
+		Ext:       snakeCase(tx.Ext),
+	}
+	if tx.Fee != nil {
+		res.Fee = &feeResponse{Amount: tx.Fee.Amount, Gas: tx.Fee.Gas}
+	}
+	for _, v := range tx.Msgs {
+		res.Msgs = append(res.Msgs, newMsgResponse(v))
+	}
+	return res
+}
+
+func newTxsResponse(txs []model.Tx) []txResponse {
+	res := make([]txResponse, 0, len(txs))
+	for _, v := range txs {
+		res = append(res, newTxResponse(v))
+	}
+	return res
+}
+
+func newMsgResponse(msg types.TxMsg) msgResponse {
+	return msgResponse{Type: msg.Type, Msg: snakeCase(msg.Msg)}
+}
+
+func newTxMsgResponse(msg model.TxMsg) txMsgResponse {
+	return txMsgResponse{
+		Time:      msg.Time,
+		TxFee:     msg.TxFee,
+		Height:    msg.Height,
+		TxHash:    msg.TxHash,
+		Type:      msg.Type,
+		MsgIndex:  msg.MsgIndex,
+		TxIndex:   msg.TxIndex,
+		TxStatus:  msg.TxStatus,
+		TxMemo:    msg.TxMemo,
+		TxLog:     msg.TxLog,
+		GasUsed:   msg.GasUsed,
+		GasWanted: msg.GasWanted,
+		Events:    msg.Events,
+		Msg:       newMsgResponse(msg.Msg),
+		Addrs:     msg.Addrs,
+		TxAddrs:   msg.TxAddrs,
+		Signers:   msg.Signers,
+		TxSigners: msg.TxSigners,
+		Denoms:    msg.Denoms,
+	}
+}
+
+func newTxMsgsResponse(msgs []model.TxMsg) []txMsgResponse {
+	res := make([]txMsgResponse, 0, len(msgs))
+	for _, v := range msgs {
+		res = append(res, newTxMsgResponse(v))
+	}
+	return res
+}
+
+func newBlockResponse(block model.Block) blockResponse {
+	return blockResponse{Height: block.Height, CreateTime: block.CreateTime, TxNum: block.TxNum}
+}
+
+func newFeedPageResponse(page feed.Page) feedPageResponse {
+	return feedPageResponse{Msgs: newTxMsgsResponse(page.Msgs), Next: page.Next, Watermark: page.Watermark}
+}
+
+// msgs of parser only have bson tags, they are converted through bson
+// so that fields are named as they are saved in db
+func snakeCase(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := bson.Marshal(bson.M{"v": v})
+	if err != nil {
+		return v
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return v
+	}
+	return doc["v"]
+}
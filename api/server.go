@@ -0,0 +1,90 @@
+// read-only query api over synced data
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type (
+	// response of list api, next is cursor of next page, it's empty if there is no more data
+	listResponse struct {
+		Data interface{} `json:"data"`
+		Next string      `json:"next,omitempty"`
+	}
+
+	errResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// start api server if api port is set, it blocks until server exits
+func Start() {
+	if conf.SvrConf.ApiPort == 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/txs", handleTxs)
+	mux.HandleFunc("/txs/", handleTx)
+	mux.HandleFunc("/msgs", handleMsgs)
+	mux.HandleFunc("/blocks/", handleBlock)
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/feed/msgs", handleFeedMsgs)
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%v", conf.SvrConf.ApiPort),
+		Handler:      readOnly(mux),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	logger.Info("start query api", logger.Int("port", conf.SvrConf.ApiPort))
+	if err := server.ListenAndServe(); err != nil {
+		logger.Error("query api exit", logger.String("err", err.Error()))
+	}
+}
+
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("write api response fail", logger.String("err", err.Error()))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, errResponse{Error: err.Error()})
+}
+
+// parse limit param, default limit is used if it's empty
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 || limit > maxLimit {
+		return 0, fmt.Errorf("limit should be in range [1,%v]", maxLimit)
+	}
+	return limit, nil
+}
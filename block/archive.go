@@ -0,0 +1,418 @@
+package block
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/utils"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// raw rpc results are archived in dir as follow:
+//   - objects/<sha256[:2]>/<sha256>.gz: gzip compressed json of rpc result,
+//     it's addressed by sha256 of json so same payload is stored once
+//   - index/<start>-<end>.jsonl: index of heights in range, one archived payload per line
+const (
+	archiveObjectDir = "objects"
+	archiveIndexDir  = "index"
+
+	archiveKindBlock = "block"
+	archiveKindTx    = "tx"
+
+	// number of ranges whose index is kept in memory, least recently used ones are evicted
+	maxArchiveIndexCacheSize = 16
+)
+
+var (
+	ErrHeightNotInArchive = errors.New("height not found in archive")
+)
+
+type (
+	// Archive store raw rpc results of blocks and txs in local dir
+	Archive struct {
+		dir       string
+		rangeSize int64
+
+		mu           sync.Mutex
+		indexes      map[int64]*list.Element // range start => element of cachedIndex in lru
+		lru          *list.List              // front is most recently used
+		maxCacheSize int
+	}
+
+	cachedIndex struct {
+		rangeStart int64
+		index      map[int64]*archiveEntry // height => entry
+	}
+
+	archiveIndexLine struct {
+		Height int64  `json:"height"`
+		Kind   string `json:"kind"`
+		TxHash string `json:"tx_hash,omitempty"`
+		Object string `json:"object"`
+	}
+
+	archiveEntry struct {
+		Block string
+		Txs   map[string]string // tx hash => object
+	}
+
+	// ArchivingSource archive results which are read from source
+	ArchivingSource struct {
+		Source
+		archive *Archive
+	}
+
+	// ArchiveSource read blocks and tx results from archive
+	ArchiveSource struct {
+		archive *Archive
+	}
+)
+
+func NewArchive(dir string, rangeSize int64) (*Archive, error) {
+	if rangeSize <= 0 {
+		return nil, fmt.Errorf("invalid archive range size %v", rangeSize)
+	}
+	for _, v := range []string{archiveObjectDir, archiveIndexDir} {
+		if err := os.MkdirAll(filepath.Join(dir, v), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Archive{
+		dir:          dir,
+		rangeSize:    rangeSize,
+		indexes:      make(map[int64]*list.Element),
+		lru:          list.New(),
+		maxCacheSize: maxArchiveIndexCacheSize,
+	}, nil
+}
+
+func (a *Archive) rangeStart(height int64) int64 {
+	return (height-1)/a.rangeSize*a.rangeSize + 1
+}
+
+func (a *Archive) indexPath(rangeStart int64) string {
+	return filepath.Join(a.dir, archiveIndexDir,
+		fmt.Sprintf("%v-%v.jsonl", rangeStart, rangeStart+a.rangeSize-1))
+}
+
+func (a *Archive) objectPath(object string) string {
+	return filepath.Join(a.dir, archiveObjectDir, object[:2], object+".gz")
+}
+
+func (a *Archive) PutBlock(res *ctypes.ResultBlock) error {
+	object, err := a.putObject(res)
+	if err != nil {
+		return err
+	}
+	return a.appendIndex(archiveIndexLine{
+		Height: res.Block.Height,
+		Kind:   archiveKindBlock,
+		Object: object,
+	})
+}
+
+func (a *Archive) PutTx(res *ctypes.ResultTx) error {
+	object, err := a.putObject(res)
+	if err != nil {
+		return err
+	}
+	return a.appendIndex(archiveIndexLine{
+		Height: res.Height,
+		Kind:   archiveKindTx,
+		TxHash: res.Hash.String(),
+		Object: object,
+	})
+}
+
+func (a *Archive) GetBlock(height int64) (*ctypes.ResultBlock, error) {
+	entry, err := a.getEntry(height)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Block == "" {
+		return nil, fmt.Errorf("%w, height: %v", ErrHeightNotInArchive, height)
+	}
+	var res ctypes.ResultBlock
+	return &res, a.getObject(entry.Block, &res)
+}
+
+func (a *Archive) GetTx(height int64, hash []byte) (*ctypes.ResultTx, error) {
+	entry, err := a.getEntry(height)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := entry.Txs[utils.BuildHex(hash)]
+	if !ok {
+		// block of height is archived but the tx isn't, height can't be served from archive
+		return nil, fmt.Errorf("%w, height: %v, tx %v not archived", ErrHeightNotInArchive, height, utils.BuildHex(hash))
+	}
+	var res ctypes.ResultTx
+	return &res, a.getObject(object, &res)
+}
+
+// max height whose block is archived
+func (a *Archive) LatestHeight() (int64, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(a.dir, archiveIndexDir))
+	if err != nil {
+		return 0, err
+	}
+	var maxRangeStart int64
+	for _, info := range infos {
+		start, err := strconv.ParseInt(strings.Split(info.Name(), "-")[0], 10, 64)
+		if err == nil && start > maxRangeStart {
+			maxRangeStart = start
+		}
+	}
+	if maxRangeStart == 0 {
+		return 0, nil
+	}
+
+	var latest int64
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	index, err := a.loadIndex(maxRangeStart)
+	if err != nil {
+		return 0, err
+	}
+	for h, v := range index {
+		if h > latest && v.Block != "" {
+			latest = h
+		}
+	}
+	return latest, nil
+}
+
+func (a *Archive) putObject(v interface{}) (string, error) {
+	data, err := tmjson.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	object := hex.EncodeToString(sum[:])
+	path := a.objectPath(object)
+	if _, err := os.Stat(path); err == nil {
+		// same payload has been archived
+		return object, nil
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		return "", err
+	}
+	if err := gw.Close(); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	// write to temp file then rename, so that reader never see a partial object
+	tmp, err := ioutil.TempFile(filepath.Dir(path), object)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return object, os.Rename(tmp.Name(), path)
+}
+
+func (a *Archive) getObject(object string, v interface{}) error {
+	f, err := os.Open(a.objectPath(object))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// object is missing if it's removed or index line is written but object isn't synced to disk
+			return fmt.Errorf("%w, object %v not found", ErrHeightNotInArchive, object)
+		}
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	data, err := ioutil.ReadAll(gr)
+	if err != nil {
+		return err
+	}
+	return tmjson.Unmarshal(data, v)
+}
+
+func (a *Archive) appendIndex(line archiveIndexLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rangeStart := a.rangeStart(line.Height)
+	f, err := os.OpenFile(a.indexPath(rangeStart), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if e, ok := a.indexes[rangeStart]; ok {
+		addIndexLine(e.Value.(*cachedIndex).index, line)
+	}
+	return nil
+}
+
+func (a *Archive) getEntry(height int64) (*archiveEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	index, err := a.loadIndex(a.rangeStart(height))
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := index[height]
+	if !ok {
+		return nil, fmt.Errorf("%w, height: %v", ErrHeightNotInArchive, height)
+	}
+	return entry, nil
+}
+
+// load index of range into memory, caller must hold lock
+func (a *Archive) loadIndex(rangeStart int64) (map[int64]*archiveEntry, error) {
+	if e, ok := a.indexes[rangeStart]; ok {
+		a.lru.MoveToFront(e)
+		return e.Value.(*cachedIndex).index, nil
+	}
+	index := make(map[int64]*archiveEntry)
+	f, err := os.Open(a.indexPath(rangeStart))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line archiveIndexLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// the last line may be partial written if process crashed
+			logger.Warn("skip invalid archive index line", logger.String("file", f.Name()),
+				logger.String("err", err.Error()))
+			continue
+		}
+		addIndexLine(index, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	a.indexes[rangeStart] = a.lru.PushFront(&cachedIndex{rangeStart: rangeStart, index: index})
+	for a.lru.Len() > a.maxCacheSize {
+		evicted := a.lru.Remove(a.lru.Back()).(*cachedIndex)
+		delete(a.indexes, evicted.rangeStart)
+	}
+	return index, nil
+}
+
+func addIndexLine(index map[int64]*archiveEntry, line archiveIndexLine) {
+	entry, ok := index[line.Height]
+	if !ok {
+		entry = &archiveEntry{Txs: make(map[string]string)}
+		index[line.Height] = entry
+	}
+	switch line.Kind {
+	case archiveKindBlock:
+		entry.Block = line.Object
+	case archiveKindTx:
+		entry.Txs[line.TxHash] = line.Object
+	}
+}
+
+// wrap source so that every block and tx result read from it is archived,
+// fail to archive is logged and doesn't break sync
+func NewArchivingSource(source Source, archive *Archive) *ArchivingSource {
+	return &ArchivingSource{Source: source, archive: archive}
+}
+
+func (s *ArchivingSource) Block(ctx context.Context, height int64) (*ctypes.ResultBlock, error) {
+	res, err := s.Source.Block(ctx, height)
+	if err != nil {
+		return res, err
+	}
+	if err := s.archive.PutBlock(res); err != nil {
+		logger.Warn("archive block fail", logger.Int64("height", height), logger.String("err", err.Error()))
+	}
+	return res, nil
+}
+
+func (s *ArchivingSource) Tx(ctx context.Context, height int64, hash []byte) (*ctypes.ResultTx, error) {
+	res, err := s.Source.Tx(ctx, height, hash)
+	if err != nil {
+		return res, err
+	}
+	if err := s.archive.PutTx(res); err != nil {
+		logger.Warn("archive tx fail", logger.Int64("height", height),
+			logger.String("txHash", utils.BuildHex(hash)), logger.String("err", err.Error()))
+	}
+	return res, nil
+}
+
+func NewArchiveSource(archive *Archive) *ArchiveSource {
+	return &ArchiveSource{archive: archive}
+}
+
+func (s *ArchiveSource) Name() string {
+	return "archive:" + s.archive.dir
+}
+
+func (s *ArchiveSource) Block(ctx context.Context, height int64) (*ctypes.ResultBlock, error) {
+	res, err := s.archive.GetBlock(height)
+	if err != nil {
+		return nil, archiveErr("archive.Block", err).WithHeight(height)
+	}
+	return res, nil
+}
+
+func (s *ArchiveSource) Tx(ctx context.Context, height int64, hash []byte) (*ctypes.ResultTx, error) {
+	res, err := s.archive.GetTx(height, hash)
+	if err != nil {
+		return nil, archiveErr("archive.Tx", err).WithHeight(height).WithTxHash(utils.BuildHex(hash))
+	}
+	return res, nil
+}
+
+// missing height, tx or object is unavailable, others are errors of reading or decoding archive files
+func archiveErr(stage string, err error) *utils.SyncError {
+	if errors.Is(err, ErrHeightNotInArchive) {
+		return utils.WrapErr(utils.ErrKindUnavailable, stage, err)
+	}
+	return utils.WrapErr(utils.ErrKindDecode, stage, err)
+}
+
+func (s *ArchiveSource) LatestHeight() int64 {
+	height, err := s.archive.LatestHeight()
+	if err != nil {
+		logger.Error("get latest height of archive fail", logger.String("err", err.Error()))
+	}
+	return height
+}
@@ -0,0 +1,150 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"github.com/irisnet/rainbow-sync/utils"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type recordSource map[int64]*dumpRecord
+
+func (s recordSource) Name() string {
+	return "record"
+}
+
+func (s recordSource) Block(ctx context.Context, height int64) (*ctypes.ResultBlock, error) {
+	return s[height].Block, nil
+}
+
+func (s recordSource) Tx(ctx context.Context, height int64, hash []byte) (*ctypes.ResultTx, error) {
+	for _, v := range s[height].TxResults {
+		if string(v.Hash) == string(hash) {
+			return v, nil
+		}
+	}
+	return nil, errors.New("tx not found")
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	records := recordSource{1: buildDumpRecord(1), 3: buildDumpRecord(3)}
+	a, err := NewArchive(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := NewArchivingSource(records, a)
+	for h, record := range records {
+		if _, err := src.Block(context.Background(), h); err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range record.TxResults {
+			if _, err := src.Tx(context.Background(), h, tx.Hash); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// read back by new archive so that index is loaded from files
+	a, err = NewArchive(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := NewArchiveSource(a)
+	if h := reader.LatestHeight(); h != 3 {
+		t.Fatalf("latest height should be 3, got %v", h)
+	}
+	for h, record := range records {
+		b, err := reader.Block(context.Background(), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Block.Hash().String() != record.Block.Block.Hash().String() {
+			t.Fatalf("block hash of height %v mismatch", h)
+		}
+		for _, tx := range record.TxResults {
+			res, err := reader.Tx(context.Background(), h, tx.Hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.TxResult.GasUsed != tx.TxResult.GasUsed {
+				t.Fatalf("tx result of height %v mismatch", h)
+			}
+		}
+	}
+	if _, err := reader.Block(context.Background(), 2); !errors.Is(err, ErrHeightNotInArchive) {
+		t.Fatalf("height 2 shouldn't be in archive, got %v", err)
+	}
+}
+
+func TestArchive_Missing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	record := buildDumpRecord(1)
+	a, err := NewArchive(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.PutBlock(record.Block); err != nil {
+		t.Fatal(err)
+	}
+	reader := NewArchiveSource(a)
+	// tx of archived block isn't archived
+	_, err = reader.Tx(context.Background(), 1, record.TxResults[0].Hash)
+	if !errors.Is(err, ErrHeightNotInArchive) || utils.ErrKindOf(err) != utils.ErrKindUnavailable {
+		t.Fatalf("missing tx should be unavailable, got %v", err)
+	}
+
+	// object of archived block is removed
+	if err := os.RemoveAll(filepath.Join(dir, archiveObjectDir)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.Block(context.Background(), 1)
+	if !errors.Is(err, ErrHeightNotInArchive) || utils.ErrKindOf(err) != utils.ErrKindUnavailable {
+		t.Fatalf("missing object should be unavailable, got %v", err)
+	}
+}
+
+func TestArchive_IndexCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := NewArchive(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.maxCacheSize = 2
+	for h := int64(1); h <= 3; h++ {
+		if err := a.PutBlock(buildDumpRecord(h).Block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, h := range []int64{1, 2, 1, 3} {
+		if _, err := a.GetBlock(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// range of height 2 is least recently used and evicted
+	if _, ok := a.indexes[2]; ok || len(a.indexes) != 2 || a.lru.Len() != 2 {
+		t.Fatalf("index cache should be bounded, cached %v ranges", len(a.indexes))
+	}
+	if _, err := a.GetBlock(2); err != nil {
+		t.Fatalf("evicted index should be loaded again, got %v", err)
+	}
+}
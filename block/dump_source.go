@@ -0,0 +1,394 @@
+package block
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/utils"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/libs/protoio"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"github.com/tendermint/tendermint/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dump files of DumpSource are named by height or height range:
+// - one height per file: <height>.json, <height>.json.gz, <height>.pb, <height>.pb.gz
+// - bundle of heights: <start>-<end>.jsonl.gz, <start>-<end>.pb.gz
+//
+// json dump of a height is an object of rpc results of /block and /tx:
+//
+//	{"block": <result of /block>, "tx_results": [<result of /tx>, ...]}
+//
+// bundled json dumps are separated by new line.
+//
+// protobuf dump of a height is a sequence of varint length delimited messages:
+//
+//	tendermint.types.BlockID, tendermint.types.Block, tendermint.abci.TxResult of every tx in block
+//
+// bundled protobuf dumps are concatenated.
+const (
+	dumpFormatJson  = "json"
+	dumpFormatJsonl = "jsonl"
+	dumpFormatPb    = "pb"
+
+	maxDumpMsgSize = 100 * 1024 * 1024
+	// number of decoded heights kept in memory, least recently used files are evicted
+	maxDumpCacheSize = 2000
+)
+
+var (
+	ErrHeightNotInDump = errors.New("height not found in dump files")
+)
+
+type (
+	// DumpSource read blocks and tx results from local dump files, so that
+	// catch up tasks can run without any rpc node
+	DumpSource struct {
+		dir     string
+		files   map[int64]dumpFile // height => file of single height
+		bundles []dumpFile         // files of height range
+
+		mu            sync.Mutex
+		cache         map[string]*list.Element // path of file => element of cachedDump in lru
+		lru           *list.List               // front is most recently used
+		cachedHeights int
+		maxCacheSize  int
+		loading       map[string]*dumpLoad // file being read, readers of same file wait for it
+	}
+
+	cachedDump struct {
+		path    string
+		records map[int64]*dumpRecord
+	}
+
+	dumpLoad struct {
+		done    chan struct{}
+		records map[int64]*dumpRecord
+		err     error
+	}
+
+	dumpFile struct {
+		path        string
+		format      string
+		compressed  bool
+		startHeight int64
+		endHeight   int64
+	}
+
+	dumpRecord struct {
+		Block     *ctypes.ResultBlock `json:"block"`
+		TxResults []*ctypes.ResultTx  `json:"tx_results"`
+	}
+)
+
+// scan dump files in dir, files which aren't named as dump file are ignored
+func NewDumpSource(dir string) (*DumpSource, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &DumpSource{
+		dir:          dir,
+		files:        make(map[int64]dumpFile),
+		cache:        make(map[string]*list.Element),
+		lru:          list.New(),
+		maxCacheSize: maxDumpCacheSize,
+		loading:      make(map[string]*dumpLoad),
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		file, ok := parseDumpFileName(info.Name())
+		if !ok {
+			continue
+		}
+		file.path = filepath.Join(dir, info.Name())
+		if file.startHeight == file.endHeight && file.format != dumpFormatJsonl {
+			s.files[file.startHeight] = file
+		} else {
+			s.bundles = append(s.bundles, file)
+		}
+	}
+	return s, nil
+}
+
+func parseDumpFileName(name string) (dumpFile, bool) {
+	var file dumpFile
+	if strings.HasSuffix(name, ".gz") {
+		file.compressed = true
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	ext := filepath.Ext(name)
+	file.format = strings.TrimPrefix(ext, ".")
+	switch file.format {
+	case dumpFormatJson, dumpFormatPb:
+	case dumpFormatJsonl:
+		if !file.compressed {
+			return file, false
+		}
+	default:
+		return file, false
+	}
+
+	heights := strings.Split(strings.TrimSuffix(name, ext), "-")
+	if len(heights) > 2 {
+		return file, false
+	}
+	var err error
+	if file.startHeight, err = strconv.ParseInt(heights[0], 10, 64); err != nil {
+		return file, false
+	}
+	file.endHeight = file.startHeight
+	if len(heights) == 2 {
+		if file.endHeight, err = strconv.ParseInt(heights[1], 10, 64); err != nil {
+			return file, false
+		}
+	}
+	return file, file.startHeight > 0 && file.startHeight <= file.endHeight
+}
+
+func (s *DumpSource) Name() string {
+	return "dump:" + s.dir
+}
+
+// max height in dump files
+func (s *DumpSource) LatestHeight() int64 {
+	var latest int64
+	for h := range s.files {
+		if h > latest {
+			latest = h
+		}
+	}
+	for _, v := range s.bundles {
+		if v.endHeight > latest {
+			latest = v.endHeight
+		}
+	}
+	return latest
+}
+
+func (s *DumpSource) Block(ctx context.Context, height int64) (*ctypes.ResultBlock, error) {
+	record, err := s.load(height)
+	if err != nil {
+		return nil, err
+	}
+	return record.Block, nil
+}
+
+func (s *DumpSource) Tx(ctx context.Context, height int64, hash []byte) (*ctypes.ResultTx, error) {
+	record, err := s.load(height)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range record.TxResults {
+		if v.Hash.String() == utils.BuildHex(hash) {
+			return v, nil
+		}
+	}
+	return nil, utils.WrapErr(utils.ErrKindUnavailable, "dump.Tx",
+		fmt.Errorf("tx not found in dump")).WithHeight(height).WithTxHash(utils.BuildHex(hash))
+}
+
+// files and bundles aren't changed after dump source is created, they are read without lock
+func (s *DumpSource) load(height int64) (*dumpRecord, error) {
+	file, ok := s.files[height]
+	if !ok {
+		for _, v := range s.bundles {
+			if v.startHeight <= height && height <= v.endHeight {
+				file, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, utils.WrapErr(utils.ErrKindUnavailable, "dump.Load", ErrHeightNotInDump).WithHeight(height)
+	}
+
+	records, err := s.loadFile(file)
+	if err != nil {
+		return nil, utils.WrapErr(utils.ErrKindDecode, "dump.Load",
+			fmt.Errorf("read dump file %v fail: %w", file.path, err)).WithHeight(height)
+	}
+	if record, ok := records[height]; ok {
+		return record, nil
+	}
+	return nil, utils.WrapErr(utils.ErrKindUnavailable, "dump.Load", ErrHeightNotInDump).WithHeight(height)
+}
+
+// get decoded records of file from cache, or read it once for all concurrent readers.
+// file is decoded without lock so that readers of other files aren't blocked
+func (s *DumpSource) loadFile(file dumpFile) (map[int64]*dumpRecord, error) {
+	s.mu.Lock()
+	if e, ok := s.cache[file.path]; ok {
+		s.lru.MoveToFront(e)
+		s.mu.Unlock()
+		return e.Value.(*cachedDump).records, nil
+	}
+	if l, ok := s.loading[file.path]; ok {
+		s.mu.Unlock()
+		<-l.done
+		return l.records, l.err
+	}
+	l := &dumpLoad{done: make(chan struct{})}
+	s.loading[file.path] = l
+	s.mu.Unlock()
+
+	records, err := readDumpFile(file)
+	if err == nil {
+		l.records = make(map[int64]*dumpRecord, len(records))
+		for _, v := range records {
+			l.records[v.Block.Block.Height] = v
+		}
+	}
+	l.err = err
+
+	s.mu.Lock()
+	delete(s.loading, file.path)
+	if err == nil {
+		s.addCache(file.path, l.records)
+	}
+	s.mu.Unlock()
+	close(l.done)
+	return l.records, l.err
+}
+
+// cache records of file, least recently used files are evicted when cached heights exceed max cache size.
+// file just read is kept even if it holds more heights than max cache size
+func (s *DumpSource) addCache(path string, records map[int64]*dumpRecord) {
+	s.cache[path] = s.lru.PushFront(&cachedDump{path: path, records: records})
+	s.cachedHeights += len(records)
+	for s.cachedHeights > s.maxCacheSize && s.lru.Len() > 1 {
+		evicted := s.lru.Remove(s.lru.Back()).(*cachedDump)
+		delete(s.cache, evicted.path)
+		s.cachedHeights -= len(evicted.records)
+	}
+}
+
+func readDumpFile(file dumpFile) ([]*dumpRecord, error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if file.compressed {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	switch file.format {
+	case dumpFormatJson:
+		return readJsonDump(r, false)
+	case dumpFormatJsonl:
+		return readJsonDump(r, true)
+	case dumpFormatPb:
+		return readPbDump(r)
+	}
+	return nil, fmt.Errorf("unknown dump format %v", file.format)
+}
+
+func readJsonDump(r io.Reader, multiple bool) ([]*dumpRecord, error) {
+	if !multiple {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var record dumpRecord
+		if err := tmjson.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		return []*dumpRecord{&record}, checkDumpRecord(&record)
+	}
+
+	var records []*dumpRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDumpMsgSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record dumpRecord
+		if err := tmjson.Unmarshal(line, &record); err != nil {
+			return nil, err
+		}
+		if err := checkDumpRecord(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, scanner.Err()
+}
+
+func readPbDump(r io.Reader) ([]*dumpRecord, error) {
+	var records []*dumpRecord
+	reader := protoio.NewDelimitedReader(r, maxDumpMsgSize)
+	for {
+		var (
+			pbBlockId tmproto.BlockID
+			pbBlock   tmproto.Block
+		)
+		if _, err := reader.ReadMsg(&pbBlockId); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return nil, err
+		}
+		if _, err := reader.ReadMsg(&pbBlock); err != nil {
+			return nil, err
+		}
+		blockId, err := types.BlockIDFromProto(&pbBlockId)
+		if err != nil {
+			return nil, err
+		}
+		block, err := types.BlockFromProto(&pbBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		record := dumpRecord{
+			Block:     &ctypes.ResultBlock{BlockID: *blockId, Block: block},
+			TxResults: make([]*ctypes.ResultTx, 0, len(block.Txs)),
+		}
+		for range block.Txs {
+			var txResult abci.TxResult
+			if _, err := reader.ReadMsg(&txResult); err != nil {
+				return nil, err
+			}
+			tx := types.Tx(txResult.Tx)
+			record.TxResults = append(record.TxResults, &ctypes.ResultTx{
+				Hash:     tx.Hash(),
+				Height:   txResult.Height,
+				Index:    txResult.Index,
+				TxResult: txResult.Result,
+				Tx:       tx,
+			})
+		}
+		records = append(records, &record)
+	}
+}
+
+func checkDumpRecord(record *dumpRecord) error {
+	if record.Block == nil || record.Block.Block == nil {
+		return fmt.Errorf("block is missing in dump")
+	}
+	return nil
+}
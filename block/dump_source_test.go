@@ -0,0 +1,153 @@
+package block
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/libs/protoio"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"github.com/tendermint/tendermint/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func buildDumpRecord(height int64) *dumpRecord {
+	txs := []types.Tx{types.Tx("tx1"), types.Tx("tx2")}
+	block := types.MakeBlock(height, txs, &types.Commit{}, nil)
+	block.ProposerAddress = make([]byte, 20)
+	record := &dumpRecord{
+		Block: &ctypes.ResultBlock{BlockID: types.BlockID{Hash: block.Hash()}, Block: block},
+	}
+	for i, tx := range txs {
+		record.TxResults = append(record.TxResults, &ctypes.ResultTx{
+			Hash:     tx.Hash(),
+			Height:   height,
+			Index:    uint32(i),
+			TxResult: abci.ResponseDeliverTx{Code: 0, GasUsed: int64(i + 1)},
+			Tx:       tx,
+		})
+	}
+	return record
+}
+
+func TestDumpSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// height 1 in json file
+	data, err := tmjson.Marshal(buildDumpRecord(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// height 2-3 in jsonl bundle
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	for h := int64(2); h <= 3; h++ {
+		data, _ := tmjson.Marshal(buildDumpRecord(h))
+		gw.Write(append(data, '\n'))
+	}
+	gw.Close()
+	if err := ioutil.WriteFile(filepath.Join(dir, "2-3.jsonl.gz"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// height 4 in protobuf file
+	buf.Reset()
+	writer := protoio.NewDelimitedWriter(&buf)
+	record := buildDumpRecord(4)
+	pbBlock, _ := record.Block.Block.ToProto()
+	pbBlockId := record.Block.BlockID.ToProto()
+	writer.WriteMsg(&pbBlockId)
+	writer.WriteMsg(pbBlock)
+	for _, v := range record.TxResults {
+		writer.WriteMsg(&abci.TxResult{Height: v.Height, Index: v.Index, Tx: v.Tx, Result: v.TxResult})
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "4.pb"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewDumpSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.LatestHeight() != 4 {
+		t.Fatalf("latest height should be 4, got %v", source.LatestHeight())
+	}
+
+	ctx := context.Background()
+	for h := int64(1); h <= 4; h++ {
+		res, err := source.Block(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Block.Height != h || len(res.Block.Txs) != 2 {
+			t.Fatalf("unexpected block of height %v", h)
+		}
+		txRes, err := source.Tx(ctx, h, res.Block.Txs[1].Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txRes.Index != 1 || txRes.TxResult.GasUsed != 2 {
+			t.Fatalf("unexpected tx result of height %v: %+v", h, txRes)
+		}
+	}
+
+	if _, err := source.Block(ctx, 5); err == nil {
+		t.Fatal("height which isn't in dump should fail")
+	}
+}
+
+func TestDumpSource_Cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for h := int64(1); h <= 3; h++ {
+		data, _ := tmjson.Marshal(buildDumpRecord(h))
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%v.json", h)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source, err := NewDumpSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.maxCacheSize = 2
+
+	// concurrent readers of same file share one read
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := source.load(1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	source.load(2)
+	source.load(1)
+	// 2 is least recently used and evicted, others are kept
+	source.load(3)
+	if _, ok := source.cache[filepath.Join(dir, "2.json")]; ok || source.cachedHeights != 2 || len(source.loading) != 0 {
+		t.Fatalf("least recently used file should be evicted, cached %v heights", source.cachedHeights)
+	}
+	if _, ok := source.cache[filepath.Join(dir, "1.json")]; !ok {
+		t.Fatal("recently used file should be kept")
+	}
+}
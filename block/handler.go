@@ -2,152 +2,232 @@ package block
 
 import (
 	"github.com/irisnet/rainbow-sync/lib/msgparser"
+	"github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/utils"
 	. "github.com/kaifei-bianjie/msg-parser/modules"
 	"github.com/kaifei-bianjie/msg-parser/modules/bank"
 	"github.com/kaifei-bianjie/msg-parser/modules/coinswap"
 	"github.com/kaifei-bianjie/msg-parser/modules/distribution"
+	"github.com/kaifei-bianjie/msg-parser/modules/gov"
+	"github.com/kaifei-bianjie/msg-parser/modules/htlc"
 	"github.com/kaifei-bianjie/msg-parser/modules/ibc"
+	"github.com/kaifei-bianjie/msg-parser/modules/service"
 	"github.com/kaifei-bianjie/msg-parser/modules/staking"
+	"github.com/kaifei-bianjie/msg-parser/modules/token"
 	"github.com/kaifei-bianjie/msg-parser/types"
 	"strings"
 )
 
-func HandleTxMsg(v types.SdkMsg) CustomMsgDocInfo {
-	var (
-		msgDoc CustomMsgDocInfo
-		denoms []string
-	)
-	if bankDocInfo, ok := msgparser.MsgClient.Bank.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = bankDocInfo
-		switch bankDocInfo.DocTxMsg.Type {
-		case MsgTypeSend:
-			doc := bankDocInfo.DocTxMsg.Msg.(*bank.DocMsgSend)
-			denoms = parseDenoms(doc.Amount)
-		case MsgTypeMultiSend:
-			doc := bankDocInfo.DocTxMsg.Msg.(*bank.DocMsgMultiSend)
-			if len(doc.Inputs) > 0 {
-				for _, v := range doc.Inputs {
-					denoms = append(denoms, parseDenoms(v.Coins)...)
-				}
-			}
-			if len(doc.Outputs) > 0 {
-				for _, v := range doc.Outputs {
-					denoms = append(denoms, parseDenoms(v.Coins)...)
-				}
-			}
+// names of default msg handlers
+const (
+	MsgHandlerBank         = "bank"
+	MsgHandlerService      = "service"
+	MsgHandlerNft          = "nft"
+	MsgHandlerRecord       = "record"
+	MsgHandlerToken        = "token"
+	MsgHandlerCoinswap     = "coinswap"
+	MsgHandlerCrisis       = "crisis"
+	MsgHandlerDistribution = "distribution"
+	MsgHandlerSlashing     = "slashing"
+	MsgHandlerEvidence     = "evidence"
+	MsgHandlerHtlc         = "htlc"
+	MsgHandlerStaking      = "staking"
+	MsgHandlerGov          = "gov"
+	MsgHandlerIbc          = "ibc"
+)
+
+func init() {
+	client := msgparser.MsgClient
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerBank, Parse: client.Bank.HandleTxMsg,
+		Enrichers: []MsgEnricher{bankDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerService, Parse: client.Service.HandleTxMsg,
+		Enrichers: []MsgEnricher{serviceDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerNft, Parse: client.Nft.HandleTxMsg})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerRecord, Parse: client.Record.HandleTxMsg})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerToken, Parse: client.Token.HandleTxMsg,
+		Enrichers: []MsgEnricher{tokenDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerCoinswap, Parse: client.Coinswap.HandleTxMsg,
+		Enrichers: []MsgEnricher{coinswapDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerCrisis, Parse: client.Crisis.HandleTxMsg})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerDistribution, Parse: client.Distribution.HandleTxMsg,
+		Enrichers: []MsgEnricher{distributionDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerSlashing, Parse: client.Slashing.HandleTxMsg})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerEvidence, Parse: client.Evidence.HandleTxMsg})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerHtlc, Parse: client.Htlc.HandleTxMsg,
+		Enrichers: []MsgEnricher{htlcDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerStaking, Parse: client.Staking.HandleTxMsg,
+		Enrichers: []MsgEnricher{stakingDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerGov, Parse: client.Gov.HandleTxMsg,
+		Enrichers: []MsgEnricher{govDenoms}})
+	RegisterMsgHandler(MsgHandler{Name: MsgHandlerIbc, Parse: client.Ibc.HandleTxMsg,
+		Enrichers: []MsgEnricher{ibcDenoms}})
+}
+
+func bankDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeSend:
+		doc := msgDoc.DocTxMsg.Msg.(*bank.DocMsgSend)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.Amount)...)
+	case MsgTypeMultiSend:
+		doc := msgDoc.DocTxMsg.Msg.(*bank.DocMsgMultiSend)
+		for _, v := range doc.Inputs {
+			msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(v.Coins)...)
+		}
+		for _, v := range doc.Outputs {
+			msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(v.Coins)...)
 		}
-		msgDoc.Denoms = removeDuplicatesFromSlice(denoms)
-		return msgDoc
-	}
-	if iServiceDocInfo, ok := msgparser.MsgClient.Service.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = iServiceDocInfo
-		return msgDoc
-	}
-	if nftDocInfo, ok := msgparser.MsgClient.Nft.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = nftDocInfo
-		return msgDoc
-	}
-	if recordDocInfo, ok := msgparser.MsgClient.Record.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = recordDocInfo
-		return msgDoc
-	}
-	if tokenDocInfo, ok := msgparser.MsgClient.Token.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = tokenDocInfo
-		return msgDoc
 	}
-	if coinswapDocInfo, ok := msgparser.MsgClient.Coinswap.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = coinswapDocInfo
-		switch coinswapDocInfo.DocTxMsg.Type {
-		case MsgTypeSwapOrder:
-			doc := coinswapDocInfo.DocTxMsg.Msg.(*coinswap.DocTxMsgSwapOrder)
-			denoms = append(denoms, parseDenoms([]types.Coin{doc.Input.Coin})...)
-			denoms = append(denoms, parseDenoms([]types.Coin{doc.Output.Coin})...)
-		case MsgTypeAddLiquidity:
-			doc := coinswapDocInfo.DocTxMsg.Msg.(*coinswap.DocTxMsgAddLiquidity)
-			denoms = append(denoms, parseDenoms([]types.Coin{doc.MaxToken})...)
-		case MsgTypeRemoveLiquidity:
-			doc := coinswapDocInfo.DocTxMsg.Msg.(*coinswap.DocTxMsgRemoveLiquidity)
-			denoms = append(denoms, parseDenoms([]types.Coin{doc.WithdrawLiquidity})...)
+}
+
+func serviceDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeBindService:
+		doc := msgDoc.DocTxMsg.Msg.(*service.DocMsgBindService)
+		for _, v := range doc.Deposit {
+			if v != nil {
+				msgDoc.Denoms = append(msgDoc.Denoms, v.Denom)
+			}
 		}
-		msgDoc.Denoms = removeDuplicatesFromSlice(denoms)
-		return msgDoc
+	case MsgTypeUpdateServiceBinding:
+		doc := msgDoc.DocTxMsg.Msg.(*service.DocMsgUpdateServiceBinding)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.Deposit)...)
+	case MsgTypeEnableServiceBinding:
+		doc := msgDoc.DocTxMsg.Msg.(*service.DocMsgEnableServiceBinding)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.Deposit)...)
+	case MsgTypeCallService:
+		doc := msgDoc.DocTxMsg.Msg.(*service.DocMsgCallService)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.ServiceFeeCap)...)
+	case MsgTypeUpdateRequestContext:
+		doc := msgDoc.DocTxMsg.Msg.(*service.DocMsgUpdateRequestContext)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.ServiceFeeCap)...)
+	case MsgTypeWithdrawEarnedFees, MsgTypeRefundServiceDeposit:
+		// amount isn't in msg, it's reported by events
+		msgDoc.Denoms = append(msgDoc.Denoms, eventDenoms(events, utils.EventTypeTransfer)...)
 	}
-	if crisisDocInfo, ok := msgparser.MsgClient.Crisis.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = crisisDocInfo
-		return msgDoc
+}
+
+func tokenDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeIssueToken:
+		doc := msgDoc.DocTxMsg.Msg.(*token.DocMsgIssueToken)
+		msgDoc.Denoms = append(msgDoc.Denoms, doc.MinUnit)
+	case MsgTypeMintToken:
+		doc := msgDoc.DocTxMsg.Msg.(*token.DocMsgMintToken)
+		msgDoc.Denoms = append(msgDoc.Denoms, mintBurnDenoms(events, doc.Symbol)...)
+	case MsgTypeBurnToken:
+		doc := msgDoc.DocTxMsg.Msg.(*token.DocMsgBurnToken)
+		msgDoc.Denoms = append(msgDoc.Denoms, mintBurnDenoms(events, doc.Symbol)...)
+	case MsgTypeTransferTokenOwner:
+		doc := msgDoc.DocTxMsg.Msg.(*token.DocMsgTransferTokenOwner)
+		msgDoc.Denoms = append(msgDoc.Denoms, doc.Symbol)
+	case MsgTypeEditToken:
+		doc := msgDoc.DocTxMsg.Msg.(*token.DocMsgEditToken)
+		msgDoc.Denoms = append(msgDoc.Denoms, doc.Symbol)
 	}
-	if distrubutionDocInfo, ok := msgparser.MsgClient.Distribution.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = distrubutionDocInfo
-		switch distrubutionDocInfo.DocTxMsg.Type {
-		case MsgTypeMsgFundCommunityPool:
-			doc := distrubutionDocInfo.DocTxMsg.Msg.(*distribution.DocTxMsgFundCommunityPool)
-			denoms = append(denoms, parseDenoms(doc.Amount)...)
-		case MsgTypeWithdrawDelegatorReward:
-		case MsgTypeMsgWithdrawValidatorCommission:
-			break
-		}
-		msgDoc.Denoms = removeDuplicatesFromSlice(denoms)
-		return msgDoc
+}
+
+// msg of mint or burn has symbol and amount of main unit, denom of min unit is reported by events.
+// failed tx has no events, symbol is taken as denom
+func mintBurnDenoms(events []model.Event, symbol string) []string {
+	if denoms := eventDenoms(events, utils.EventTypeTransfer, utils.EventTypeCoinbase, utils.EventTypeBurn); len(denoms) > 0 {
+		return denoms
 	}
-	if slashingDocInfo, ok := msgparser.MsgClient.Slashing.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = slashingDocInfo
-		return msgDoc
+	return []string{symbol}
+}
+
+func coinswapDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeSwapOrder:
+		doc := msgDoc.DocTxMsg.Msg.(*coinswap.DocTxMsgSwapOrder)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms([]types.Coin{doc.Input.Coin})...)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms([]types.Coin{doc.Output.Coin})...)
+	case MsgTypeAddLiquidity:
+		doc := msgDoc.DocTxMsg.Msg.(*coinswap.DocTxMsgAddLiquidity)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms([]types.Coin{doc.MaxToken})...)
+	case MsgTypeRemoveLiquidity:
+		doc := msgDoc.DocTxMsg.Msg.(*coinswap.DocTxMsgRemoveLiquidity)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms([]types.Coin{doc.WithdrawLiquidity})...)
 	}
-	if evidenceDocInfo, ok := msgparser.MsgClient.Evidence.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = evidenceDocInfo
-		return msgDoc
+}
+
+func distributionDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeMsgFundCommunityPool:
+		doc := msgDoc.DocTxMsg.Msg.(*distribution.DocTxMsgFundCommunityPool)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.Amount)...)
+	case MsgTypeWithdrawDelegatorReward:
+		// rewards actually received are reported by events
+		msgDoc.Denoms = append(msgDoc.Denoms, eventDenoms(events, utils.EventTypeWithdrawRewards)...)
+	case MsgTypeMsgWithdrawValidatorCommission:
+		msgDoc.Denoms = append(msgDoc.Denoms, eventDenoms(events, utils.EventTypeWithdrawCommission)...)
 	}
-	if htlcDocInfo, ok := msgparser.MsgClient.Htlc.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = htlcDocInfo
-		return msgDoc
+}
+
+func htlcDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeCreateHTLC:
+		doc := msgDoc.DocTxMsg.Msg.(*htlc.DocTxMsgCreateHTLC)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.Amount)...)
+	case MsgTypeClaimHTLC, MsgTypeRefundHTLC:
+		// amount of htlc is reported by events
+		msgDoc.Denoms = append(msgDoc.Denoms, eventDenoms(events, utils.EventTypeTransfer)...)
 	}
-	if stakingDocInfo, ok := msgparser.MsgClient.Staking.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = stakingDocInfo
-		switch stakingDocInfo.DocTxMsg.Type {
-		case MsgTypeStakeDelegate:
-			doc := stakingDocInfo.DocTxMsg.Msg.(*staking.DocTxMsgDelegate)
-			denoms = append(denoms, parseDenoms(convertCoins([]Coin{doc.Amount}))...)
-		case MsgTypeStakeBeginUnbonding:
-			doc := stakingDocInfo.DocTxMsg.Msg.(*staking.DocTxMsgBeginUnbonding)
-			denoms = append(denoms, parseDenoms([]types.Coin{doc.Amount})...)
-		case MsgTypeBeginRedelegate:
-			doc := stakingDocInfo.DocTxMsg.Msg.(*staking.DocTxMsgBeginRedelegate)
-			denoms = append(denoms, parseDenoms([]types.Coin{doc.Amount})...)
-		}
-		msgDoc.Denoms = removeDuplicatesFromSlice(denoms)
-		return msgDoc
+}
+
+func stakingDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeStakeCreateValidator:
+		doc := msgDoc.DocTxMsg.Msg.(*staking.DocTxMsgCreateValidator)
+		msgDoc.Denoms = append(msgDoc.Denoms, doc.Value.Denom)
+	case MsgTypeStakeDelegate:
+		doc := msgDoc.DocTxMsg.Msg.(*staking.DocTxMsgDelegate)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(convertCoins([]Coin{doc.Amount}))...)
+	case MsgTypeStakeBeginUnbonding:
+		doc := msgDoc.DocTxMsg.Msg.(*staking.DocTxMsgBeginUnbonding)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms([]types.Coin{doc.Amount})...)
+	case MsgTypeBeginRedelegate:
+		doc := msgDoc.DocTxMsg.Msg.(*staking.DocTxMsgBeginRedelegate)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms([]types.Coin{doc.Amount})...)
 	}
-	if govDocInfo, ok := msgparser.MsgClient.Gov.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = govDocInfo
-		return msgDoc
+}
+
+func govDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeSubmitProposal:
+		doc := msgDoc.DocTxMsg.Msg.(*gov.DocTxMsgSubmitProposal)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.InitialDeposit)...)
+	case MsgTypeDeposit:
+		doc := msgDoc.DocTxMsg.Msg.(*gov.DocTxMsgDeposit)
+		msgDoc.Denoms = append(msgDoc.Denoms, parseDenoms(doc.Amount)...)
 	}
-	if ibcDocInfo, ok := msgparser.MsgClient.Ibc.HandleTxMsg(v); ok {
-		msgDoc.MsgDocInfo = ibcDocInfo
-		switch ibcDocInfo.DocTxMsg.Type {
-		case MsgTypeIBCTransfer:
-			doc := ibcDocInfo.DocTxMsg.Msg.(*ibc.DocMsgTransfer)
-			denoms = append(denoms, doc.Token.Denom)
-		case MsgTypeTimeout:
-			doc := ibcDocInfo.DocTxMsg.Msg.(*ibc.DocMsgTimeout)
-			denom := doc.Packet.Data.Denom
-			if strings.Contains(denom, "/") {
-				denom = ibc.GetIbcPacketDenom(doc.Packet, doc.Packet.Data.Denom)
-			}
-			denoms = append(denoms, denom)
-		case MsgTypeRecvPacket:
-			doc := ibcDocInfo.DocTxMsg.Msg.(*ibc.DocMsgRecvPacket)
-			denom := doc.Packet.Data.Denom
-			if strings.Contains(denom, "/") {
-				denom = ibc.GetIbcPacketDenom(doc.Packet, doc.Packet.Data.Denom)
-			}
-			denoms = append(denoms, denom)
+}
+
+func ibcDenoms(msgDoc *CustomMsgDocInfo, events []model.Event) {
+	switch msgDoc.DocTxMsg.Type {
+	case MsgTypeIBCTransfer:
+		doc := msgDoc.DocTxMsg.Msg.(*ibc.DocMsgTransfer)
+		msgDoc.Denoms = append(msgDoc.Denoms, doc.Token.Denom)
+	case MsgTypeTimeout:
+		// token of timeout packet is refunded to sender on this chain, like timeout on close
+		doc := msgDoc.DocTxMsg.Msg.(*ibc.DocMsgTimeout)
+		msgDoc.Denoms = append(msgDoc.Denoms, sentPacketDenom(doc.Packet.Data.Denom))
+	case MsgTypeRecvPacket:
+		doc := msgDoc.DocTxMsg.Msg.(*ibc.DocMsgRecvPacket)
+		denom := doc.Packet.Data.Denom
+		if strings.Contains(denom, "/") {
+			denom = ibc.GetIbcPacketDenom(doc.Packet, doc.Packet.Data.Denom)
 		}
-		msgDoc.Denoms = removeDuplicatesFromSlice(denoms)
-		return msgDoc
+		msgDoc.Denoms = append(msgDoc.Denoms, denom)
+	case MsgTypeAcknowledgement:
+		doc := msgDoc.DocTxMsg.Msg.(*ibc.DocMsgAcknowledgement)
+		msgDoc.Denoms = append(msgDoc.Denoms, sentPacketDenom(doc.Packet.Data.Denom))
+	case MsgTypeTimeoutOnClose:
+		doc := msgDoc.DocTxMsg.Msg.(*ibc.DocMsgTimeoutOnClose)
+		msgDoc.Denoms = append(msgDoc.Denoms, sentPacketDenom(doc.Packet.Data.Denom))
 	}
-	return msgDoc
 }
 
+// remove duplicates and keep order of first occurrence, so that parsed docs are deterministic
 func removeDuplicatesFromSlice(data []string) (result []string) {
 	tempSet := make(map[string]string, len(data))
 	for _, val := range data {
@@ -155,9 +235,7 @@ func removeDuplicatesFromSlice(data []string) (result []string) {
 			continue
 		}
 		tempSet[val] = val
-	}
-	for one := range tempSet {
-		result = append(result, one)
+		result = append(result, val)
 	}
 	return
 }
@@ -0,0 +1,148 @@
+package block
+
+import (
+	"github.com/irisnet/rainbow-sync/model"
+	. "github.com/kaifei-bianjie/msg-parser/modules"
+	"github.com/kaifei-bianjie/msg-parser/modules/distribution"
+	"github.com/kaifei-bianjie/msg-parser/modules/gov"
+	"github.com/kaifei-bianjie/msg-parser/modules/htlc"
+	"github.com/kaifei-bianjie/msg-parser/modules/ibc"
+	"github.com/kaifei-bianjie/msg-parser/modules/service"
+	"github.com/kaifei-bianjie/msg-parser/modules/token"
+	msgsdktypes "github.com/kaifei-bianjie/msg-parser/types"
+	"reflect"
+	"testing"
+)
+
+func TestMsgDenoms(t *testing.T) {
+	rewardEvents := []model.Event{
+		{Type: "message", Attributes: []model.KvPair{{Key: "action", Value: "withdraw_delegator_reward"}}},
+		{Type: "withdraw_rewards", Attributes: []model.KvPair{
+			{Key: "amount", Value: "1234uiris,5ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+			{Key: "validator", Value: "iva1pyysjzgfpyysjzgfpyysjzgfpyysjzgfag7330"},
+		}},
+	}
+	tests := []struct {
+		name     string
+		enricher MsgEnricher
+		msgType  string
+		msg      msgsdktypes.Msg
+		events   []model.Event
+		want     []string
+	}{
+		{
+			name:     "withdraw reward from events",
+			enricher: distributionDenoms,
+			msgType:  MsgTypeWithdrawDelegatorReward,
+			msg:      &distribution.DocTxMsgWithdrawDelegatorReward{},
+			events:   rewardEvents,
+			want:     []string{"uiris", "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+		},
+		{
+			name:     "gov deposit",
+			enricher: govDenoms,
+			msgType:  MsgTypeDeposit,
+			msg:      &gov.DocTxMsgDeposit{Amount: []msgsdktypes.Coin{{Denom: "uiris", Amount: "10"}}},
+			want:     []string{"uiris"},
+		},
+		{
+			name:     "create htlc",
+			enricher: htlcDenoms,
+			msgType:  MsgTypeCreateHTLC,
+			msg:      &htlc.DocTxMsgCreateHTLC{Amount: []msgsdktypes.Coin{{Denom: "htltbcbnb", Amount: "1"}}},
+			want:     []string{"htltbcbnb"},
+		},
+		{
+			name:     "bind service",
+			enricher: serviceDenoms,
+			msgType:  MsgTypeBindService,
+			msg:      &service.DocMsgBindService{Deposit: Coins{{Denom: "uiris", Amount: "100"}}},
+			want:     []string{"uiris"},
+		},
+		{
+			name:     "issue token",
+			enricher: tokenDenoms,
+			msgType:  MsgTypeIssueToken,
+			msg:      &token.DocMsgIssueToken{Symbol: "btc", MinUnit: "ubtc"},
+			want:     []string{"ubtc"},
+		},
+		{
+			name:     "mint token from events",
+			enricher: tokenDenoms,
+			msgType:  MsgTypeMintToken,
+			msg:      &token.DocMsgMintToken{Symbol: "btc", Amount: "1"},
+			events: []model.Event{{Type: "coinbase", Attributes: []model.KvPair{
+				{Key: "minter", Value: "iaa1"}, {Key: "amount", Value: "1000000ubtc"}}}},
+			want: []string{"ubtc"},
+		},
+		{
+			name:     "mint token of failed tx",
+			enricher: tokenDenoms,
+			msgType:  MsgTypeMintToken,
+			msg:      &token.DocMsgMintToken{Symbol: "btc", Amount: "1"},
+			want:     []string{"btc"},
+		},
+		{
+			name:     "burn token of failed tx",
+			enricher: tokenDenoms,
+			msgType:  MsgTypeBurnToken,
+			msg:      &token.DocMsgBurnToken{Symbol: "btc", Amount: "1"},
+			want:     []string{"btc"},
+		},
+		{
+			name:     "transfer token owner",
+			enricher: tokenDenoms,
+			msgType:  MsgTypeTransferTokenOwner,
+			msg:      &token.DocMsgTransferTokenOwner{Symbol: "btc", SrcOwner: "iaa1", DstOwner: "iaa2"},
+			want:     []string{"btc"},
+		},
+		{
+			name:     "edit token",
+			enricher: tokenDenoms,
+			msgType:  MsgTypeEditToken,
+			msg:      &token.DocMsgEditToken{Symbol: "btc", Owner: "iaa1"},
+			want:     []string{"btc"},
+		},
+		{
+			name:     "acknowledge packet of received token",
+			enricher: ibcDenoms,
+			msgType:  MsgTypeAcknowledgement,
+			msg: &ibc.DocMsgAcknowledgement{Packet: ibc.Packet{Data: ibc.PacketData{
+				Denom: "transfer/channel-1/uatom"}}},
+			want: []string{"ibc/C4CFF46FD6DE35CA4CF4CE031E643C8FDC9BA4B99AE598E9B0ED98FE3A2319F9"},
+		},
+		{
+			name:     "timeout packet of received token",
+			enricher: ibcDenoms,
+			msgType:  MsgTypeTimeout,
+			msg: &ibc.DocMsgTimeout{Packet: ibc.Packet{SourcePort: "transfer", SourceChannel: "channel-2",
+				Data: ibc.PacketData{Denom: "transfer/channel-1/uatom"}}},
+			want: []string{"ibc/C4CFF46FD6DE35CA4CF4CE031E643C8FDC9BA4B99AE598E9B0ED98FE3A2319F9"},
+		},
+		{
+			name:     "timeout on close packet of received token",
+			enricher: ibcDenoms,
+			msgType:  MsgTypeTimeoutOnClose,
+			msg: &ibc.DocMsgTimeoutOnClose{Packet: ibc.Packet{SourcePort: "transfer", SourceChannel: "channel-2",
+				Data: ibc.PacketData{Denom: "transfer/channel-1/uatom"}}},
+			want: []string{"ibc/C4CFF46FD6DE35CA4CF4CE031E643C8FDC9BA4B99AE598E9B0ED98FE3A2319F9"},
+		},
+		{
+			name:     "timeout packet of native token",
+			enricher: ibcDenoms,
+			msgType:  MsgTypeTimeout,
+			msg:      &ibc.DocMsgTimeout{Packet: ibc.Packet{Data: ibc.PacketData{Denom: "uiris"}}},
+			want:     []string{"uiris"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := CustomMsgDocInfo{}
+			doc.DocTxMsg = msgsdktypes.TxMsg{Type: tt.msgType, Msg: tt.msg}
+			tt.enricher(&doc, tt.events)
+			if !reflect.DeepEqual(doc.Denoms, tt.want) {
+				t.Errorf("got denoms %v, want %v", doc.Denoms, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package block
 
 import (
 	"fmt"
+	"github.com/cosmos/cosmos-sdk/x/auth/signing"
 	"github.com/irisnet/rainbow-sync/db"
 	"github.com/irisnet/rainbow-sync/lib/logger"
-	"github.com/irisnet/rainbow-sync/lib/pool"
+	"github.com/irisnet/rainbow-sync/lib/tracing"
 	"github.com/irisnet/rainbow-sync/model"
 	"github.com/irisnet/rainbow-sync/utils"
 	"github.com/kaifei-bianjie/msg-parser/codec"
@@ -13,16 +14,23 @@ import (
 	msgsdktypes "github.com/kaifei-bianjie/msg-parser/types"
 	aTypes "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/types"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/context"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/mgo.v2/txn"
 	"time"
 )
 
-func SaveDocsWithTxn(blockDoc *model.Block, txs []*model.Tx, txMsgs []model.TxMsg, taskDoc model.SyncTask) error {
+func SaveDocsWithTxn(ctx context.Context, blockDoc *model.Block, txs []*model.Tx, txMsgs []model.TxMsg, taskDoc model.SyncTask) error {
 	var (
 		ops, insertOps []txn.Op
 	)
+	_, span := tracing.Start(ctx, "block.SaveDocsWithTxn",
+		attribute.Int64("height", blockDoc.Height),
+		attribute.String("task_id", taskDoc.ID.Hex()),
+		attribute.Int("tx_num", len(txs)),
+		attribute.Int("msg_num", len(txMsgs)))
+	defer span.End()
 
 	if blockDoc.Height == 0 {
 		return fmt.Errorf("invalid block, height equal 0")
@@ -56,74 +64,71 @@ func SaveDocsWithTxn(blockDoc *model.Block, txs []*model.Tx, txMsgs []model.TxMs
 		}
 	}
 
-	updateOp := txn.Op{
-		C:      model.CollectionNameSyncTask,
-		Id:     taskDoc.ID,
-		Assert: txn.DocExists,
-		Update: bson.M{
-			"$set": bson.M{
-				"current_height":   taskDoc.CurrentHeight,
-				"status":           taskDoc.Status,
-				"last_update_time": taskDoc.LastUpdateTime,
-			},
-		},
-	}
+	// commit of worker whose task has been taken over or released is rejected
+	updateOp := taskDoc.CommitOp(taskDoc)
 
+	// ops are applied in order, task is updated last so that
+	// docs of height have been inserted when current height of task is visible
 	ops = make([]txn.Op, 0, txAndMsgNum+2)
-	ops = append(append(ops, blockOp, updateOp), insertOps...)
+	ops = append(append(append(ops, blockOp), insertOps...), updateOp)
 
 	if len(ops) > 0 {
-		err := db.Txn(ops)
+		err := db.Txn(ctx, ops)
 		if err != nil {
-			return err
+			span.RecordError(err)
+			return utils.WrapErr(utils.ErrKindDb, "SaveDocs", err).WithHeight(blockDoc.Height)
 		}
 	}
 
 	return nil
 }
 
-func ParseBlock(b int64, client *pool.Client) (*model.Block, []*model.Tx, []model.TxMsg, error) {
+// panic of decoding msgs is returned as decode error, which isn't retryable.
+// other panics, such as nil result of flaky node, are recovered as unknown error and retried
+func ParseBlock(ctx context.Context, b int64, source Source) (blockDoc *model.Block, txs []*model.Tx, docMsgs []model.TxMsg, err error) {
+	ctx, span := tracing.Start(ctx, "block.ParseBlock",
+		attribute.Int64("height", b),
+		attribute.String("endpoint", source.Name()))
+
+	// lines of logger bound to ctx carry height and task of the block
+	log := logger.FromContext(ctx)
 
 	defer func() {
-		if err := recover(); err != nil {
-			logger.Error("parse  block fail", logger.Int64("height", b),
-				logger.Any("err", err))
+		if r := recover(); r != nil {
+			log.Error("parse  block fail", logger.Any("err", r))
+			err = utils.WrapErr(utils.ErrKindUnknown, "ParseBlock", fmt.Errorf("recovered panic: %v", r)).WithHeight(b)
+			blockDoc, txs, docMsgs = nil, nil, nil
+			span.RecordError(err)
 		}
+		span.End()
 	}()
-	ctx := context.Background()
-	resblock, err := client.Block(ctx, &b)
+	resblock, err := source.Block(ctx, b)
 	if err != nil {
-		time.Sleep(1 * time.Second)
-		// there is possible parse block fail when in iterator
-		var err2 error
-		client2 := pool.GetClient()
-		resblock, err2 = client2.Block(ctx, &b)
-		client2.Release()
-		if err2 != nil {
-			return nil, nil, nil, utils.ConvertErr(b, "", "ParseBlock", err2)
-		}
+		span.RecordError(err)
+		return nil, nil, nil, utils.WrapErr(utils.ErrKindUnknown, "ParseBlock", err).WithHeight(b)
 	}
-	blockDoc := model.Block{
+	doc := model.Block{
 		Height:     b,
 		CreateTime: time.Now().Unix(),
+		TxNum:      int64(len(resblock.Block.Txs)),
 	}
-	txs := make([]*model.Tx, 0, len(resblock.Block.Txs))
-	var docMsgs []model.TxMsg
+	txs = make([]*model.Tx, 0, len(resblock.Block.Txs))
 	for _, tx := range resblock.Block.Txs {
-		tx, msgs, err := ParseTx(tx, resblock.Block, client)
+		tx, msgs, err := ParseTx(ctx, tx, resblock.Block, source)
 		if err != nil {
-			return &blockDoc, txs, docMsgs, err
+			span.RecordError(err)
+			return &doc, txs, docMsgs, err
 		}
 		if tx.Height > 0 {
 			txs = append(txs, &tx)
 			docMsgs = append(docMsgs, msgs...)
 		}
 	}
-	return &blockDoc, txs, docMsgs, nil
+	return &doc, txs, docMsgs, nil
 }
 
 // parse iris tx from iris block result tx
-func ParseTx(txBytes types.Tx, block *types.Block, client *pool.Client) (model.Tx, []model.TxMsg, error) {
+func ParseTx(ctx context.Context, txBytes types.Tx, block *types.Block, source Source) (model.Tx, []model.TxMsg, error) {
 
 	var (
 		docMsgs   []model.TxMsg
@@ -133,27 +138,37 @@ func ParseTx(txBytes types.Tx, block *types.Block, client *pool.Client) (model.T
 	)
 	height := block.Height
 	txHash := utils.BuildHex(txBytes.Hash())
-	authTx, err := codec.GetSigningTx(txBytes)
+	ctx, span := tracing.Start(ctx, "block.ParseTx",
+		attribute.Int64("height", height),
+		attribute.String("tx_hash", txHash))
+	defer span.End()
+	log := logger.FromContext(ctx)
+
+	_, decodeSpan := tracing.Start(ctx, "msgparser.GetSigningTx", attribute.String("tx_hash", txHash))
+	var (
+		authTx signing.Tx
+		err    error
+	)
+	if perr := recoverDecode("GetSigningTx", func() { authTx, err = codec.GetSigningTx(txBytes) }); perr != nil {
+		decodeSpan.RecordError(perr)
+		decodeSpan.End()
+		return docTx, docMsgs, perr.WithHeight(height).WithTxHash(txHash)
+	}
+	decodeSpan.RecordError(err)
+	decodeSpan.End()
 	if err != nil {
-		logger.Warn(err.Error(),
-			logger.String("errTag", "TxDecoder"),
-			logger.String("txhash", txHash),
-			logger.Int64("height", block.Height))
+		log.Warn(err.Error(),
+			logger.String("errKind", string(utils.ErrKindDecode)),
+			logger.String("txhash", txHash))
 		return docTx, docMsgs, nil
 	}
 	fee := msgsdktypes.BuildFee(authTx.GetFee(), authTx.GetGas())
 	memo := authTx.GetMemo()
-	ctx := context.Background()
-	res, err := client.Tx(ctx, txBytes.Hash(), false)
+	res, err := source.Tx(ctx, height, txBytes.Hash())
 	if err != nil {
-		time.Sleep(1 * time.Second)
-		var err1 error
-		client2 := pool.GetClient()
-		res, err1 = client2.Tx(ctx, txBytes.Hash(), false)
-		client2.Release()
-		if err1 != nil {
-			return docTx, docMsgs, utils.ConvertErr(block.Height, txHash, "TxResult", err1)
-		}
+		span.RecordError(err)
+		return docTx, docMsgs, utils.WrapErr(utils.ErrKindUnknown, "TxResult", err).WithHeight(block.Height).
+			WithTxHash(txHash)
 	}
 
 	if len(fee.Amount) > 0 {
@@ -186,8 +201,14 @@ func ParseTx(txBytes types.Tx, block *types.Block, client *pool.Client) (model.T
 	if len(msgs) == 0 {
 		return docTx, docMsgs, nil
 	}
+	_, handleSpan := tracing.Start(ctx, "msgparser.HandleTxMsg", attribute.Int("msg_num", len(msgs)))
+	defer handleSpan.End()
 	for i, v := range msgs {
-		msgDocInfo := HandleTxMsg(v)
+		var msgDocInfo CustomMsgDocInfo
+		if perr := recoverDecode("HandleTxMsg", func() { msgDocInfo = HandleTxMsg(v, eventsIndexMap[i].Events) }); perr != nil {
+			handleSpan.RecordError(perr)
+			return docTx, docMsgs, perr.WithHeight(height).WithTxHash(txHash)
+		}
 		if len(msgDocInfo.Addrs) == 0 {
 			continue
 		}
@@ -201,10 +222,10 @@ func ParseTx(txBytes types.Tx, block *types.Block, client *pool.Client) (model.T
 				}
 
 			} else {
-				logger.Warn("ibc transfer handler packet_id failed", logger.String("errTag", "TxMsg"),
-					logger.String("txhash", txHash),
-					logger.Int("msg_index", i),
-					logger.Int64("height", height))
+				log.Warn("ibc transfer handler packet_id failed", append(utils.ErrFields(
+					utils.WrapErr(utils.ErrKindDecode, "PacketId", fmt.Errorf("unexpected msg %T", msgDocInfo.DocTxMsg.Msg)).
+						WithHeight(height).WithTxHash(txHash)),
+					logger.Int("msg_index", i))...)
 			}
 		}
 
@@ -244,10 +265,9 @@ func ParseTx(txBytes types.Tx, block *types.Block, client *pool.Client) (model.T
 
 	// don't save txs which have not parsed
 	if len(docTx.Addrs) == 0 {
-		logger.Warn(utils.NoSupportMsgTypeTag,
-			logger.String("errTag", "TxMsg"),
-			logger.String("txhash", txHash),
-			logger.Int64("height", height))
+		log.Warn(utils.NoSupportMsgTypeTag, utils.ErrFields(
+			utils.WrapErr(utils.ErrKindDecode, "TxMsg", fmt.Errorf("no msg of tx is supported")).
+				WithHeight(height).WithTxHash(txHash))...)
 		return docTx, docMsgs, nil
 	}
 
@@ -259,6 +279,17 @@ func ParseTx(txBytes types.Tx, block *types.Block, client *pool.Client) (model.T
 
 }
 
+// run decoding of tx or msg, panic raised inside is returned as decode error which isn't retryable
+func recoverDecode(stage string, fn func()) (err *utils.SyncError) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = utils.WrapErr(utils.ErrKindDecode, stage, fmt.Errorf("recovered panic: %v", r))
+		}
+	}()
+	fn()
+	return nil
+}
+
 //unique index: (height,tx_index)
 //txIndex: max value is 9999
 //return height*10000+tx_index
@@ -1,44 +1,107 @@
 package block
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"github.com/irisnet/rainbow-sync/lib/pool"
+	"github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
-func TestIris_Block_ParseIrisTx(t *testing.T) {
-	client := pool.GetClient()
-	defer func() {
-		client.Release()
-	}()
-	type args struct {
-		b      int64
+var (
+	recordNode = flag.String("record", "", "rpc node which fixtures of corpus heights are recorded from")
+	update     = flag.Bool("update", false, "update golden files with parsed output")
+)
+
+const (
+	rpcFixtureDir = "testdata/rpc"
+	goldenDir     = "testdata/golden"
+)
+
+var (
+	// synthetic heights, their fixtures in testdata/rpc are hand-built in the recorded format
+	// to cover msg types which are rare on chain, they can't be recorded again
+	syntheticHeights = []int64{101, 102}
+	// irishub-1 heights recorded from a mainnet node with
+	// go test -run TestParseBlockGolden -record <node> -update,
+	// height whose golden file isn't recorded yet is skipped on replay
+	mainnetHeights = []int64{3742170}
+)
+
+type goldenOutput struct {
+	Txs    []*model.Tx   `json:"txs"`
+	TxMsgs []model.TxMsg `json:"tx_msgs"`
+}
+
+func TestParseBlockGolden(t *testing.T) {
+	var (
 		client *pool.Client
+		err    error
+	)
+	if *recordNode != "" {
+		client, err = pool.NewRecordClient(*recordNode, rpcFixtureDir)
+	} else {
+		client, err = pool.NewReplayClient(rpcFixtureDir)
+	}
+	if err != nil {
+		t.Fatal(err)
 	}
-	tests := []struct {
-		name string
-		args args
-	}{
-		{
-			name: "test parse iris tx",
-			args: args{
-				b:      3742170,
-				client: client,
-			},
-		},
+	source := NewRpcSource(client)
+
+	heights := mainnetHeights
+	if *recordNode == "" {
+		heights = append(syntheticHeights, heights...)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			block, res, msg, err := ParseBlock(tt.args.b, tt.args.client)
+	for _, height := range heights {
+		t.Run(fmt.Sprint(height), func(t *testing.T) {
+			path := filepath.Join(goldenDir, fmt.Sprintf("%v.json", height))
+			if _, err := os.Stat(path); os.IsNotExist(err) && *recordNode == "" {
+				t.Skipf("fixture of height %v isn't recorded, run with -record <node> -update", height)
+			}
+			_, txs, txMsgs, err := ParseBlock(context.Background(), height, source)
 			if err != nil {
 				t.Fatal(err)
 			}
-			resBytes, _ := json.Marshal(block)
-			t.Log(string(resBytes))
-			resBytes, _ = json.Marshal(res)
-			t.Log(string(resBytes))
-			resBytes, _ = json.Marshal(msg)
-			t.Log(string(resBytes))
+			got, err := json.MarshalIndent(goldenOutput{Txs: txs, TxMsgs: txMsgs}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err := ioutil.WriteFile(path, append(got, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(want), got) {
+				t.Errorf("parsed output of height %v differs from %v, got:\n%s", height, path, got)
+			}
 		})
 	}
 }
+
+func TestParseBlock_Panic(t *testing.T) {
+	// source without the height panics like client returning nil result, it's retried
+	_, _, _, err := ParseBlock(context.Background(), 1, recordSource{})
+	if err == nil || utils.ErrKindOf(err) != utils.ErrKindUnknown || !utils.IsRetryable(err) {
+		t.Fatalf("panic of source should be retryable, got %v", err)
+	}
+
+	err = recoverDecode("HandleTxMsg", func() { panic("unknown msg") })
+	if utils.ErrKindOf(err) != utils.ErrKindDecode || utils.IsRetryable(err) {
+		t.Fatalf("panic of decoding msg should be decode error, got %v", err)
+	}
+	if err := recoverDecode("HandleTxMsg", func() {}); err != nil {
+		t.Fatalf("decoding without panic shouldn't fail, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package block
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/irisnet/rainbow-sync/model"
+	. "github.com/kaifei-bianjie/msg-parser/modules"
+	"github.com/kaifei-bianjie/msg-parser/types"
+	"sync"
+)
+
+type (
+	// MsgParser parse msg into doc, return false if msg doesn't belong to the module
+	// it has same signature as HandleTxMsg of msg-parser module clients
+	MsgParser func(v sdk.Msg) (MsgDocInfo, bool)
+
+	// MsgEnricher fill extra info of parsed msg doc, such as denoms,
+	// events are emitted by the msg, they are empty if tx failed
+	MsgEnricher func(doc *CustomMsgDocInfo, events []model.Event)
+
+	// MsgHandler parse msgs of a module, msg is handled by the first handler whose parser accepts it
+	MsgHandler struct {
+		Name      string
+		Parse     MsgParser
+		Enrichers []MsgEnricher
+	}
+)
+
+// handlers are copied on write, so that HandleTxMsg reads them without holding lock
+var (
+	msgHandlersMu sync.RWMutex
+	msgHandlers   []MsgHandler
+)
+
+// register handler at the end of handlers,
+// handler with same name is replaced in place
+func RegisterMsgHandler(handler MsgHandler) {
+	msgHandlersMu.Lock()
+	defer msgHandlersMu.Unlock()
+	handlers := copyMsgHandlers()
+	if i := msgHandlerIndex(handlers, handler.Name); i >= 0 {
+		handlers[i] = handler
+	} else {
+		handlers = append(handlers, handler)
+	}
+	msgHandlers = handlers
+}
+
+// register handler before handler of name, so that it's tried first
+func RegisterMsgHandlerBefore(name string, handler MsgHandler) error {
+	msgHandlersMu.Lock()
+	defer msgHandlersMu.Unlock()
+	handlers := copyMsgHandlers()
+	if i := msgHandlerIndex(handlers, handler.Name); i >= 0 {
+		handlers = append(handlers[:i], handlers[i+1:]...)
+	}
+	i := msgHandlerIndex(handlers, name)
+	if i < 0 {
+		return fmt.Errorf("msg handler %v isn't registered", name)
+	}
+	msgHandlers = append(handlers[:i], append([]MsgHandler{handler}, handlers[i:]...)...)
+	return nil
+}
+
+// add enricher to registered handler of name, it's called after existing enrichers
+func AddMsgEnricher(name string, enricher MsgEnricher) error {
+	msgHandlersMu.Lock()
+	defer msgHandlersMu.Unlock()
+	handlers := copyMsgHandlers()
+	i := msgHandlerIndex(handlers, name)
+	if i < 0 {
+		return fmt.Errorf("msg handler %v isn't registered", name)
+	}
+	enrichers := make([]MsgEnricher, 0, len(handlers[i].Enrichers)+1)
+	handlers[i].Enrichers = append(append(enrichers, handlers[i].Enrichers...), enricher)
+	msgHandlers = handlers
+	return nil
+}
+
+// names of registered handlers in order
+func MsgHandlerNames() []string {
+	msgHandlersMu.RLock()
+	defer msgHandlersMu.RUnlock()
+	names := make([]string, 0, len(msgHandlers))
+	for _, v := range msgHandlers {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// caller must hold lock
+func copyMsgHandlers() []MsgHandler {
+	return append(make([]MsgHandler, 0, len(msgHandlers)+1), msgHandlers...)
+}
+
+func msgHandlerIndex(handlers []MsgHandler, name string) int {
+	for i, v := range handlers {
+		if v.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func HandleTxMsg(v types.SdkMsg, events []model.Event) CustomMsgDocInfo {
+	var msgDoc CustomMsgDocInfo
+	msgHandlersMu.RLock()
+	handlers := msgHandlers
+	msgHandlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		docInfo, ok := handler.Parse(v)
+		if !ok {
+			continue
+		}
+		msgDoc.MsgDocInfo = docInfo
+		for _, enrich := range handler.Enrichers {
+			enrich(&msgDoc, events)
+		}
+		msgDoc.Denoms = removeDuplicatesFromSlice(msgDoc.Denoms)
+		return msgDoc
+	}
+	return msgDoc
+}
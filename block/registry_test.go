@@ -0,0 +1,59 @@
+package block
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/irisnet/rainbow-sync/model"
+	. "github.com/kaifei-bianjie/msg-parser/modules"
+	msgsdktypes "github.com/kaifei-bianjie/msg-parser/types"
+	"reflect"
+	"testing"
+)
+
+func TestMsgHandlerRegistry(t *testing.T) {
+	defaults := msgHandlers
+	defer func() {
+		msgHandlers = defaults
+	}()
+
+	custom := MsgHandler{
+		Name: "custom",
+		Parse: func(v sdk.Msg) (MsgDocInfo, bool) {
+			return MsgDocInfo{DocTxMsg: msgsdktypes.TxMsg{Type: "custom"}}, true
+		},
+		Enrichers: []MsgEnricher{func(doc *CustomMsgDocInfo, events []model.Event) {
+			doc.Denoms = append(doc.Denoms, "uiris")
+		}},
+	}
+	if err := RegisterMsgHandlerBefore(MsgHandlerBank, custom); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddMsgEnricher("custom", func(doc *CustomMsgDocInfo, events []model.Event) {
+		doc.Denoms = append(doc.Denoms, "uiris", "ubtc")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if names := MsgHandlerNames(); names[0] != "custom" || names[1] != MsgHandlerBank || len(names) != len(defaults)+1 {
+		t.Fatalf("unexpected handler order %v", names)
+	}
+	if len(defaults[0].Enrichers) != 1 {
+		t.Fatal("registered handlers shouldn't be changed in place")
+	}
+
+	doc := HandleTxMsg(nil, nil)
+	if doc.DocTxMsg.Type != "custom" || !reflect.DeepEqual(doc.Denoms, []string{"uiris", "ubtc"}) {
+		t.Fatalf("unexpected doc %+v", doc)
+	}
+
+	// register again with same name replace it in place
+	custom.Enrichers = nil
+	RegisterMsgHandler(custom)
+	if names := MsgHandlerNames(); names[0] != "custom" {
+		t.Fatalf("unexpected handler order %v", names)
+	}
+	if doc := HandleTxMsg(nil, nil); len(doc.Denoms) != 0 {
+		t.Fatalf("unexpected denoms %v", doc.Denoms)
+	}
+	if err := AddMsgEnricher("unknown", nil); err == nil {
+		t.Fatal("add enricher to unknown handler should fail")
+	}
+}
@@ -0,0 +1,140 @@
+package block
+
+import (
+	"context"
+	"github.com/irisnet/rainbow-sync/lib/pool"
+	"github.com/irisnet/rainbow-sync/lib/retry"
+	"github.com/irisnet/rainbow-sync/lib/tracing"
+	"github.com/irisnet/rainbow-sync/utils"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Source provide blocks and tx results which are parsed by ParseBlock and ParseTx,
+// blocks can be read from rpc nodes or local dump files with same model output
+type Source interface {
+	// name of source, such as node address or dump dir
+	Name() string
+	Block(ctx context.Context, height int64) (*ctypes.ResultBlock, error)
+	Tx(ctx context.Context, height int64, hash []byte) (*ctypes.ResultTx, error)
+}
+
+// OfflineSource is source which has fixed range of heights, such as dump files or archive
+type OfflineSource interface {
+	Source
+	// max height which can be read from source
+	LatestHeight() int64
+}
+
+// RpcSource read blocks from rpc nodes with client borrowed from pool
+type RpcSource struct {
+	client *pool.Client
+}
+
+func NewRpcSource(client *pool.Client) *RpcSource {
+	return &RpcSource{client: client}
+}
+
+func (s *RpcSource) Name() string {
+	return s.client.Address
+}
+
+// release client to pool
+func (s *RpcSource) Release() {
+	s.client.Release()
+}
+
+func (s *RpcSource) Block(ctx context.Context, height int64) (*ctypes.ResultBlock, error) {
+	var res *ctypes.ResultBlock
+	err := retry.Do(ctx, "rpc.Block", retry.Default(), func(attempt int) error {
+		client, release, err := s.attemptClient(height, attempt)
+		if err != nil {
+			return err
+		}
+		defer release()
+		res, err = fetchBlock(ctx, height, client)
+		return err
+	})
+	return res, err
+}
+
+func (s *RpcSource) Tx(ctx context.Context, height int64, hash []byte) (*ctypes.ResultTx, error) {
+	var res *ctypes.ResultTx
+	err := retry.Do(ctx, "rpc.Tx", retry.Default(), func(attempt int) error {
+		client, release, err := s.attemptClient(height, attempt)
+		if err != nil {
+			return err
+		}
+		defer release()
+		res, err = fetchTx(ctx, hash, client)
+		return err
+	})
+	return res, err
+}
+
+// first attempt uses client of source, retry attempts use another client borrowed from pool
+// because node of source may be failing, returned func releases the client of attempt
+func (s *RpcSource) attemptClient(height int64, attempt int) (*pool.Client, func(), error) {
+	if attempt == 1 || !s.pooled() {
+		if err := s.switchClient(height); err != nil {
+			return nil, nil, err
+		}
+		return s.client, func() {}, nil
+	}
+	c, err := pool.GetClientForHeight(s.client.Role, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, c.Release, nil
+}
+
+// client which isn't borrowed from pool, such as replay client,
+// has no other client to retry with
+func (s *RpcSource) pooled() bool {
+	return s.client.Role != ""
+}
+
+// node of client may have pruned the block, switch to a node which holds it
+func (s *RpcSource) switchClient(height int64) error {
+	if s.client.CanServe(height) {
+		return nil
+	}
+	c, err := pool.GetClientForHeight(s.client.Role, height)
+	if err != nil {
+		return err
+	}
+	s.client.Release()
+	s.client = c
+	return nil
+}
+
+// get block from node, the rpc call is traced with the endpoint of client
+func fetchBlock(ctx context.Context, b int64, client *pool.Client) (*ctypes.ResultBlock, error) {
+	ctx, span := tracing.Start(ctx, "rpc.Block",
+		attribute.Int64("height", b),
+		attribute.String("endpoint", client.Address))
+	defer span.End()
+
+	res, err := client.Block(ctx, &b)
+	span.RecordError(err)
+	if err != nil {
+		return nil, utils.WrapErr(utils.ErrKindRpc, "rpc.Block", err).WithHeight(b).WithEndPoint(client.Address)
+	}
+	return res, nil
+}
+
+// get tx result from node, the rpc call is traced with the endpoint of client
+func fetchTx(ctx context.Context, hash []byte, client *pool.Client) (*ctypes.ResultTx, error) {
+	ctx, span := tracing.Start(ctx, "rpc.Tx",
+		attribute.String("tx_hash", utils.BuildHex(hash)),
+		attribute.String("endpoint", client.Address))
+	defer span.End()
+
+	res, err := client.Tx(ctx, hash, false)
+	span.RecordError(err)
+	if err != nil {
+		return nil, utils.WrapErr(utils.ErrKindRpc, "rpc.Tx", err).WithTxHash(utils.BuildHex(hash)).
+			WithEndPoint(client.Address)
+	}
+	return res, nil
+}
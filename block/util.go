@@ -1,7 +1,13 @@
 package block
 
-import "github.com/kaifei-bianjie/msg-parser/types"
-import m "github.com/kaifei-bianjie/msg-parser/modules"
+import (
+	"github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/utils"
+	m "github.com/kaifei-bianjie/msg-parser/modules"
+	"github.com/kaifei-bianjie/msg-parser/types"
+	msgutils "github.com/kaifei-bianjie/msg-parser/utils"
+	"strings"
+)
 
 func parseDenoms(coins []types.Coin) []string {
 	if len(coins) == 0 {
@@ -30,3 +36,43 @@ func convertCoins(mCoins []m.Coin) types.Coins {
 
 	return coins
 }
+
+// parse denoms from amount attribute of events whose type in eventTypes,
+// amount is coins such as 100uiris,5ubtc
+func eventDenoms(events []model.Event, eventTypes ...string) []string {
+	var denoms []string
+	for _, e := range events {
+		if !containsString(eventTypes, e.Type) {
+			continue
+		}
+		for _, attr := range e.Attributes {
+			if attr.Key != utils.EventAttrKeyAmount {
+				continue
+			}
+			for _, coin := range strings.Split(attr.Value, ",") {
+				if denom := strings.TrimLeft(strings.TrimSpace(coin), "0123456789."); denom != "" {
+					denoms = append(denoms, denom)
+				}
+			}
+		}
+	}
+	return denoms
+}
+
+// denom on this chain of token sent by packet, denom in packet is full trace path
+// if the token was received from other chain before
+func sentPacketDenom(packetDenom string) string {
+	if strings.Contains(packetDenom, "/") {
+		return msgutils.IBCDenom(packetDenom)
+	}
+	return packetDenom
+}
+
+func containsString(data []string, s string) bool {
+	for _, v := range data {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
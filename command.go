@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/task"
+	"os"
+	"strconv"
+)
+
+const (
+	// rainbow-sync retry-quarantined [height...]
+	CommandRetryQuarantined = "retry-quarantined"
+	// rainbow-sync status
+	CommandStatus = "status"
+)
+
+// run sub command instead of sync server, return false if name isn't a command
+func runCommand(name string, args []string) bool {
+	switch name {
+	case CommandRetryQuarantined:
+		heights := make([]int64, 0, len(args))
+		for _, v := range args {
+			h, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || h <= 0 {
+				fmt.Fprintf(os.Stderr, "invalid height %v\n", v)
+				os.Exit(2)
+			}
+			heights = append(heights, h)
+		}
+		db.Start()
+		defer db.Stop()
+		n, err := task.RetryQuarantined(heights)
+		if err != nil {
+			logger.Fatal("retry quarantined heights fail", logger.String("err", err.Error()))
+		}
+		fmt.Printf("%v quarantined heights are set to retry\n", n)
+	case CommandStatus:
+		db.Start()
+		defer db.Stop()
+		status, err := task.GetClusterStatus()
+		if err != nil {
+			logger.Fatal("get cluster status fail", logger.String("err", err.Error()))
+		}
+		if err := task.WriteClusterStatus(os.Stdout, status); err != nil {
+			logger.Fatal("print cluster status fail", logger.String("err", err.Error()))
+		}
+	default:
+		return false
+	}
+	return true
+}
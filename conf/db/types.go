@@ -4,6 +4,7 @@ import (
 	constant "github.com/irisnet/rainbow-sync/conf"
 	"github.com/irisnet/rainbow-sync/lib/logger"
 	"os"
+	"strconv"
 )
 
 var (
@@ -11,6 +12,11 @@ var (
 	User     = "iris"
 	Passwd   = "irispassword"
 	Database = "rainbow-server"
+
+	// indexes created besides indexes declared by docs, format: collection:key1,-key2;collection:key1
+	ExtraIndexes = ""
+	// drop indexes which are neither declared by docs nor in extra indexes
+	DropExtraIndexes = false
 )
 
 // get value of env var
@@ -35,7 +41,20 @@ func init() {
 		Database = database
 	}
 
+	if v, found := os.LookupEnv(constant.EnvNameDbExtraIndexes); found {
+		ExtraIndexes = v
+	}
+
+	if v, found := os.LookupEnv(constant.EnvNameDbDropExtraIndexes); found {
+		drop, err := strconv.ParseBool(v)
+		if err != nil {
+			logger.Fatal("convert str to bool fail", logger.String(constant.EnvNameDbDropExtraIndexes, v))
+		}
+		DropExtraIndexes = drop
+	}
+
 	logger.Debug("init db config", logger.String("addrs", Addrs),
 		logger.Bool("userIsEmpty", User == ""), logger.Bool("passwdIsEmpty", Passwd == ""),
-		logger.String("database", Database))
+		logger.String("database", Database), logger.String("extraIndexes", ExtraIndexes),
+		logger.Bool("dropExtraIndexes", DropExtraIndexes))
 }
@@ -1,6 +1,9 @@
 package conf
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"github.com/irisnet/rainbow-sync/lib/logger"
 	"github.com/irisnet/rainbow-sync/utils"
 	"os"
@@ -17,11 +20,59 @@ var (
 	workerMaxSleepTime      = 2 * 60
 	blockNumPerWorkerHandle = 50
 
-	initConnectionNum = 50  // fast init num of tendermint client pool
-	maxConnectionNum  = 100 // max size of tendermint client pool
+	archiveNodeUrls              []string // use blockChainMonitorUrl when not specified
+	tipNodeUrls                  []string // use blockChainMonitorUrl when not specified
+	archivePoolInitConnectionNum = 50     // fast init num of archive node client pool
+	archivePoolMaxConnectionNum  = 100    // max size of archive node client pool
+	tipPoolInitConnectionNum     = 5      // fast init num of tip node client pool
+	tipPoolMaxConnectionNum      = 20     // max size of tip node client pool
+
 	behindBlockNum    = 0
 	bech32ChainPrefix = "i"
 	promethousPort    = 9090
+	apiPort           = 0  // query api is disabled when port is 0
+	adminPort         = 0  // admin api is disabled when port is 0
+	adminToken        = "" // bearer token of admin api, requests aren't authorized when it's empty
+
+	poolBreakerFailureThreshold = 3
+	poolBreakerOpenSeconds      = 30
+	poolEndPointRps             = 0.0 // no limit when rps <= 0
+	poolEndPointMaxInFlight     = 0   // no limit when max in flight <= 0
+	poolEndPointRateLimits      = map[string]EndPointRateLimit{}
+
+	syncSource = SyncSourceRpc
+	dumpDir    = "./dump"
+
+	archiveDir       = "" // archive is disabled when dir is empty
+	archiveRangeSize = int64(10000)
+
+	traceExporter     = "none"
+	traceOtlpEndpoint = "http://localhost:4318"
+	traceSampler      = "traceidratio"
+	traceSamplerRatio = 1.0
+	traceServiceName  = "rainbow-sync"
+
+	rpcFixtureMode = "" // rpc responses are neither recorded nor replayed when mode is empty
+	rpcFixtureDir  = "./fixtures"
+
+	retryMaxAttempts       = 3
+	retryInitialBackoffMs  = 500
+	retryMaxBackoffMs      = 30 * 1000
+	retryBackoffMultiplier = 2.0
+	retryJitter            = 0.2              // fraction of backoff which is randomized
+	retryKindMaxAttempts   = map[string]int{} // max attempts of error kind, override retryMaxAttempts
+
+	quarantineMaxFailures = 10 // heights are retried forever when it's 0
+
+	shutdownTimeout = 30 // seconds waiting for workers to release tasks on shutdown
+
+	schedulingPolicy = SchedulingPolicyRandom
+
+	taskTargetTxNum = 2000 // catch up tasks are sized by BlockNumPerWorkerHandle when it's 0
+	taskMinBlockNum = 10
+	taskMaxBlockNum = 1000
+
+	plannerLeaseSeconds = 30 // lease of instance which plans tasks, it's renewed three times in a lease
 )
 
 type ServerConf struct {
@@ -31,11 +82,93 @@ type ServerConf struct {
 	WorkerMaxSleepTime      int
 	BlockNumPerWorkerHandle int
 
-	MaxConnectionNum  int
-	InitConnectionNum int
+	NodePools         map[string]NodePoolConf // client pool conf of node role
 	BehindBlockNum    int
 	Bech32ChainPrefix string
 	PromethousPort    int
+	ApiPort           int
+	AdminPort         int
+	AdminToken        string `json:"-"` // not printed with conf
+
+	PoolBreakerFailureThreshold int
+	PoolBreakerOpenSeconds      int
+	PoolEndPointRps             float64
+	PoolEndPointMaxInFlight     int
+	PoolEndPointRateLimits      map[string]EndPointRateLimit
+
+	SyncSource string
+	DumpDir    string
+
+	ArchiveDir       string
+	ArchiveRangeSize int64
+
+	TraceExporter     string
+	TraceOtlpEndpoint string
+	TraceSampler      string
+	TraceSamplerRatio float64
+	TraceServiceName  string
+
+	RpcFixtureMode string
+	RpcFixtureDir  string
+
+	RetryMaxAttempts       int
+	RetryInitialBackoffMs  int
+	RetryMaxBackoffMs      int
+	RetryBackoffMultiplier float64
+	RetryJitter            float64
+	RetryKindMaxAttempts   map[string]int
+
+	QuarantineMaxFailures int
+
+	ShutdownTimeout int
+
+	SchedulingPolicy string
+
+	TaskTargetTxNum int
+	TaskMinBlockNum int
+	TaskMaxBlockNum int
+
+	PlannerLeaseSeconds int
+}
+
+// catch up tasks use nodes of archive role which hold complete history,
+// follow tasks and latest height query use nodes of tip role which are close to chain tip
+const (
+	NodeRoleArchive = "archive"
+	NodeRoleTip     = "tip"
+)
+
+// record responses of rpc nodes to fixture files, or replay them without rpc nodes
+const (
+	RpcFixtureModeRecord = "record"
+	RpcFixtureModeReplay = "replay"
+)
+
+// policy of choosing catch up task to execute, follow tasks are always executed first.
+// priority policy chooses task randomly weighted by priority of task
+const (
+	SchedulingPolicyOldest   = "oldest"
+	SchedulingPolicyNewest   = "newest"
+	SchedulingPolicyRandom   = "random"
+	SchedulingPolicyPriority = "priority"
+)
+
+// source of blocks, read blocks from rpc nodes, local dump files or archive captured by previous sync
+const (
+	SyncSourceRpc     = "rpc"
+	SyncSourceDump    = "dump"
+	SyncSourceArchive = "archive"
+)
+
+type NodePoolConf struct {
+	NodeUrls          []string
+	MaxConnectionNum  int
+	InitConnectionNum int
+}
+
+type EndPointRateLimit struct {
+	RequestsPerSecond float64
+	MaxInFlight       int
 }
 
 const (
@@ -44,13 +177,54 @@ const (
 	EnvNameDbPassWd   = "DB_PASSWD"
 	EnvNameDbDataBase = "DB_DATABASE"
 
-	EnvNameSerNetworkFullNodes     = "SER_BC_FULL_NODES"
-	EnvNameWorkerNumExecuteTask    = "WORKER_NUM_EXECUTE_TASK"
-	EnvNameWorkerMaxSleepTime      = "WORKER_MAX_SLEEP_TIME"
-	EnvNameBlockNumPerWorkerHandle = "BLOCK_NUM_PER_WORKER_HANDLE"
-	EnvNameBehindBlockNum          = "BEHIND_BLOCK_NUM"
-	EnvNameBech32ChainPrefix       = "BECH32_CHAIN_PREFIX"
-	EnvNamePromethousPort          = "PROMETHOUS_PORT"
+	EnvNameDbExtraIndexes     = "DB_EXTRA_INDEXES"
+	EnvNameDbDropExtraIndexes = "DB_DROP_EXTRA_INDEXES"
+
+	EnvNameSerNetworkFullNodes         = "SER_BC_FULL_NODES"
+	EnvNameSerNetworkArchiveNodes      = "SER_BC_ARCHIVE_NODES"
+	EnvNameSerNetworkTipNodes          = "SER_BC_TIP_NODES"
+	EnvNameArchivePoolMaxConnNum       = "ARCHIVE_POOL_MAX_CONNECTION_NUM"
+	EnvNameArchivePoolInitConnNum      = "ARCHIVE_POOL_INIT_CONNECTION_NUM"
+	EnvNameTipPoolMaxConnNum           = "TIP_POOL_MAX_CONNECTION_NUM"
+	EnvNameTipPoolInitConnNum          = "TIP_POOL_INIT_CONNECTION_NUM"
+	EnvNameWorkerNumExecuteTask        = "WORKER_NUM_EXECUTE_TASK"
+	EnvNameWorkerMaxSleepTime          = "WORKER_MAX_SLEEP_TIME"
+	EnvNameBlockNumPerWorkerHandle     = "BLOCK_NUM_PER_WORKER_HANDLE"
+	EnvNameBehindBlockNum              = "BEHIND_BLOCK_NUM"
+	EnvNameBech32ChainPrefix           = "BECH32_CHAIN_PREFIX"
+	EnvNamePromethousPort              = "PROMETHOUS_PORT"
+	EnvNameApiPort                     = "API_PORT"
+	EnvNameAdminPort                   = "ADMIN_PORT"
+	EnvNameAdminToken                  = "ADMIN_TOKEN"
+	EnvNamePoolBreakerFailureThreshold = "POOL_BREAKER_FAILURE_THRESHOLD"
+	EnvNamePoolBreakerOpenSeconds      = "POOL_BREAKER_OPEN_SECONDS"
+	EnvNamePoolEndPointRps             = "POOL_ENDPOINT_RPS"
+	EnvNamePoolEndPointMaxInFlight     = "POOL_ENDPOINT_MAX_IN_FLIGHT"
+	EnvNamePoolEndPointRateLimits      = "POOL_ENDPOINT_RATE_LIMITS"
+	EnvNameSyncSource                  = "SYNC_SOURCE"
+	EnvNameDumpDir                     = "DUMP_DIR"
+	EnvNameArchiveDir                  = "ARCHIVE_DIR"
+	EnvNameArchiveRangeSize            = "ARCHIVE_RANGE_SIZE"
+	EnvNameTraceExporter               = "TRACE_EXPORTER"
+	EnvNameTraceOtlpEndpoint           = "TRACE_OTLP_ENDPOINT"
+	EnvNameTraceSampler                = "TRACE_SAMPLER"
+	EnvNameTraceSamplerRatio           = "TRACE_SAMPLER_RATIO"
+	EnvNameTraceServiceName            = "TRACE_SERVICE_NAME"
+	EnvNameRpcFixtureMode              = "RPC_FIXTURE_MODE"
+	EnvNameRpcFixtureDir               = "RPC_FIXTURE_DIR"
+	EnvNameRetryMaxAttempts            = "RETRY_MAX_ATTEMPTS"
+	EnvNameRetryInitialBackoffMs       = "RETRY_INITIAL_BACKOFF_MS"
+	EnvNameRetryMaxBackoffMs           = "RETRY_MAX_BACKOFF_MS"
+	EnvNameRetryBackoffMultiplier      = "RETRY_BACKOFF_MULTIPLIER"
+	EnvNameRetryJitter                 = "RETRY_JITTER"
+	EnvNameRetryKindMaxAttempts        = "RETRY_KIND_MAX_ATTEMPTS"
+	EnvNameQuarantineMaxFailures       = "QUARANTINE_MAX_FAILURES"
+	EnvNameShutdownTimeout             = "SHUTDOWN_TIMEOUT"
+	EnvNameSchedulingPolicy            = "SCHEDULING_POLICY"
+	EnvNameTaskTargetTxNum             = "TASK_TARGET_TX_NUM"
+	EnvNameTaskMinBlockNum             = "TASK_MIN_BLOCK_NUM"
+	EnvNameTaskMaxBlockNum             = "TASK_MAX_BLOCK_NUM"
+	EnvNamePlannerLeaseSeconds         = "PLANNER_LEASE_SECONDS"
 )
 
 // get value of env var
@@ -61,6 +235,25 @@ func init() {
 	if found {
 		blockChainMonitorUrl = strings.Split(nodeUrl, ",")
 	}
+	archiveNodeUrls, tipNodeUrls = blockChainMonitorUrl, blockChainMonitorUrl
+	if v, found := os.LookupEnv(EnvNameSerNetworkArchiveNodes); found {
+		archiveNodeUrls = strings.Split(v, ",")
+	}
+	if v, found := os.LookupEnv(EnvNameSerNetworkTipNodes); found {
+		tipNodeUrls = strings.Split(v, ",")
+	}
+	for env, value := range map[string]*int{
+		EnvNameArchivePoolMaxConnNum:  &archivePoolMaxConnectionNum,
+		EnvNameArchivePoolInitConnNum: &archivePoolInitConnectionNum,
+		EnvNameTipPoolMaxConnNum:      &tipPoolMaxConnectionNum,
+		EnvNameTipPoolInitConnNum:     &tipPoolInitConnectionNum,
+	} {
+		if v, found := os.LookupEnv(env); found {
+			if *value, err = strconv.Atoi(v); err != nil {
+				logger.Fatal("Can't convert str to int", logger.String(env, v))
+			}
+		}
+	}
 
 	if v, found := os.LookupEnv(EnvNameWorkerNumExecuteTask); found {
 		workerNumExecuteTask, err = strconv.Atoi(v)
@@ -98,6 +291,177 @@ func init() {
 			promethousPort = n
 		}
 	}
+	if v, ok := os.LookupEnv(EnvNameApiPort); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			logger.Fatal("convert str to int fail", logger.String(EnvNameApiPort, v))
+		} else {
+			apiPort = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameAdminPort); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			logger.Fatal("convert str to int fail", logger.String(EnvNameAdminPort, v))
+		} else {
+			adminPort = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameAdminToken); ok {
+		adminToken = v
+	}
+	if v, ok := os.LookupEnv(EnvNamePoolBreakerFailureThreshold); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			logger.Fatal("convert str to int fail", logger.String(EnvNamePoolBreakerFailureThreshold, v))
+		} else {
+			poolBreakerFailureThreshold = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNamePoolBreakerOpenSeconds); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			logger.Fatal("convert str to int fail", logger.String(EnvNamePoolBreakerOpenSeconds, v))
+		} else {
+			poolBreakerOpenSeconds = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNamePoolEndPointRps); ok {
+		if n, err := strconv.ParseFloat(v, 64); err != nil {
+			logger.Fatal("convert str to float fail", logger.String(EnvNamePoolEndPointRps, v))
+		} else {
+			poolEndPointRps = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNamePoolEndPointMaxInFlight); ok {
+		if n, err := strconv.Atoi(v); err != nil {
+			logger.Fatal("convert str to int fail", logger.String(EnvNamePoolEndPointMaxInFlight, v))
+		} else {
+			poolEndPointMaxInFlight = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNamePoolEndPointRateLimits); ok {
+		if poolEndPointRateLimits, err = parseEndPointRateLimits(v); err != nil {
+			logger.Fatal("parse end point rate limits fail", logger.String(EnvNamePoolEndPointRateLimits, v),
+				logger.String("err", err.Error()))
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameSyncSource); ok {
+		if v != SyncSourceRpc && v != SyncSourceDump && v != SyncSourceArchive {
+			logger.Fatal("unknown sync source", logger.String(EnvNameSyncSource, v))
+		}
+		syncSource = v
+	}
+	if v, ok := os.LookupEnv(EnvNameDumpDir); ok {
+		dumpDir = v
+	}
+	if v, ok := os.LookupEnv(EnvNameArchiveDir); ok {
+		archiveDir = v
+	}
+	if v, ok := os.LookupEnv(EnvNameArchiveRangeSize); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err != nil || n <= 0 {
+			logger.Fatal("invalid archive range size", logger.String(EnvNameArchiveRangeSize, v))
+		} else {
+			archiveRangeSize = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameTraceExporter); ok {
+		traceExporter = v
+	}
+	if v, ok := os.LookupEnv(EnvNameTraceOtlpEndpoint); ok {
+		traceOtlpEndpoint = v
+	}
+	if v, ok := os.LookupEnv(EnvNameTraceSampler); ok {
+		traceSampler = v
+	}
+	if v, ok := os.LookupEnv(EnvNameTraceSamplerRatio); ok {
+		if n, err := strconv.ParseFloat(v, 64); err != nil {
+			logger.Fatal("convert str to float fail", logger.String(EnvNameTraceSamplerRatio, v))
+		} else {
+			traceSamplerRatio = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameTraceServiceName); ok {
+		traceServiceName = v
+	}
+	if v, ok := os.LookupEnv(EnvNameRpcFixtureMode); ok {
+		if v != "" && v != RpcFixtureModeRecord && v != RpcFixtureModeReplay {
+			logger.Fatal("unknown rpc fixture mode", logger.String(EnvNameRpcFixtureMode, v))
+		}
+		rpcFixtureMode = v
+	}
+	if v, ok := os.LookupEnv(EnvNameRpcFixtureDir); ok {
+		rpcFixtureDir = v
+	}
+	for env, value := range map[string]*int{
+		EnvNameRetryMaxAttempts:      &retryMaxAttempts,
+		EnvNameRetryInitialBackoffMs: &retryInitialBackoffMs,
+		EnvNameRetryMaxBackoffMs:     &retryMaxBackoffMs,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			if *value, err = strconv.Atoi(v); err != nil || *value < 0 {
+				logger.Fatal("invalid retry conf", logger.String(env, v))
+			}
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameRetryBackoffMultiplier); ok {
+		if retryBackoffMultiplier, err = strconv.ParseFloat(v, 64); err != nil || retryBackoffMultiplier < 1 {
+			logger.Fatal("invalid retry backoff multiplier", logger.String(EnvNameRetryBackoffMultiplier, v))
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameRetryJitter); ok {
+		if retryJitter, err = strconv.ParseFloat(v, 64); err != nil || retryJitter < 0 || retryJitter > 1 {
+			logger.Fatal("invalid retry jitter", logger.String(EnvNameRetryJitter, v))
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameRetryKindMaxAttempts); ok {
+		if retryKindMaxAttempts, err = parseRetryKindMaxAttempts(v); err != nil {
+			logger.Fatal("parse retry kind max attempts fail", logger.String(EnvNameRetryKindMaxAttempts, v),
+				logger.String("err", err.Error()))
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameQuarantineMaxFailures); ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			logger.Fatal("invalid quarantine max failures", logger.String(EnvNameQuarantineMaxFailures, v))
+		} else {
+			quarantineMaxFailures = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameShutdownTimeout); ok {
+		if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+			logger.Fatal("invalid shutdown timeout", logger.String(EnvNameShutdownTimeout, v))
+		} else {
+			shutdownTimeout = n
+		}
+	}
+	if v, ok := os.LookupEnv(EnvNameSchedulingPolicy); ok {
+		switch v {
+		case SchedulingPolicyOldest, SchedulingPolicyNewest, SchedulingPolicyRandom, SchedulingPolicyPriority:
+			schedulingPolicy = v
+		default:
+			logger.Fatal("unknown scheduling policy", logger.String(EnvNameSchedulingPolicy, v))
+		}
+	}
+	for env, value := range map[string]*int{
+		EnvNameTaskTargetTxNum: &taskTargetTxNum,
+		EnvNameTaskMinBlockNum: &taskMinBlockNum,
+		EnvNameTaskMaxBlockNum: &taskMaxBlockNum,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				logger.Fatal("invalid task sizing", logger.String(env, v))
+			} else {
+				*value = n
+			}
+		}
+	}
+	if taskMinBlockNum == 0 || taskMinBlockNum > taskMaxBlockNum {
+		logger.Fatal("task min block num should be in range [1, max block num]",
+			logger.Int("min", taskMinBlockNum), logger.Int("max", taskMaxBlockNum))
+	}
+	if v, ok := os.LookupEnv(EnvNamePlannerLeaseSeconds); ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 3 {
+			logger.Fatal("planner lease should be at least 3 seconds", logger.String(EnvNamePlannerLeaseSeconds, v))
+		} else {
+			plannerLeaseSeconds = n
+		}
+	}
 	SvrConf = &ServerConf{
 		NodeUrls:                blockChainMonitorUrl,
 		WorkerNumCreateTask:     workerNumCreateTask,
@@ -105,11 +469,134 @@ func init() {
 		WorkerMaxSleepTime:      workerMaxSleepTime,
 		BlockNumPerWorkerHandle: blockNumPerWorkerHandle,
 
-		MaxConnectionNum:  maxConnectionNum,
-		InitConnectionNum: initConnectionNum,
+		NodePools: map[string]NodePoolConf{
+			NodeRoleArchive: {
+				NodeUrls:          archiveNodeUrls,
+				MaxConnectionNum:  archivePoolMaxConnectionNum,
+				InitConnectionNum: archivePoolInitConnectionNum,
+			},
+			NodeRoleTip: {
+				NodeUrls:          tipNodeUrls,
+				MaxConnectionNum:  tipPoolMaxConnectionNum,
+				InitConnectionNum: tipPoolInitConnectionNum,
+			},
+		},
 		BehindBlockNum:    behindBlockNum,
 		Bech32ChainPrefix: bech32ChainPrefix,
 		PromethousPort:    promethousPort,
+		ApiPort:           apiPort,
+		AdminPort:         adminPort,
+		AdminToken:        adminToken,
+
+		PoolBreakerFailureThreshold: poolBreakerFailureThreshold,
+		PoolBreakerOpenSeconds:      poolBreakerOpenSeconds,
+		PoolEndPointRps:             poolEndPointRps,
+		PoolEndPointMaxInFlight:     poolEndPointMaxInFlight,
+		PoolEndPointRateLimits:      poolEndPointRateLimits,
+
+		SyncSource: syncSource,
+		DumpDir:    dumpDir,
+
+		ArchiveDir:       archiveDir,
+		ArchiveRangeSize: archiveRangeSize,
+
+		TraceExporter:     traceExporter,
+		TraceOtlpEndpoint: traceOtlpEndpoint,
+		TraceSampler:      traceSampler,
+		TraceSamplerRatio: traceSamplerRatio,
+		TraceServiceName:  traceServiceName,
+
+		RpcFixtureMode: rpcFixtureMode,
+		RpcFixtureDir:  rpcFixtureDir,
+
+		RetryMaxAttempts:       retryMaxAttempts,
+		RetryInitialBackoffMs:  retryInitialBackoffMs,
+		RetryMaxBackoffMs:      retryMaxBackoffMs,
+		RetryBackoffMultiplier: retryBackoffMultiplier,
+		RetryJitter:            retryJitter,
+		RetryKindMaxAttempts:   retryKindMaxAttempts,
+
+		QuarantineMaxFailures: quarantineMaxFailures,
+
+		ShutdownTimeout: shutdownTimeout,
+
+		SchedulingPolicy: schedulingPolicy,
+
+		TaskTargetTxNum: taskTargetTxNum,
+		TaskMinBlockNum: taskMinBlockNum,
+		TaskMaxBlockNum: taskMaxBlockNum,
+
+		PlannerLeaseSeconds: plannerLeaseSeconds,
 	}
 	logger.Debug("print server config", logger.String("serverConf", utils.MarshalJsonIgnoreErr(SvrConf)))
 }
+
+// hash of server config, instances running with different config can be told apart
+func (c *ServerConf) Hash() string {
+	sum := sha256.Sum256([]byte(utils.MarshalJsonIgnoreErr(c)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// get rate limit of end point, use default limit if the end point isn't specified
+func (c *ServerConf) GetEndPointRateLimit(address string) EndPointRateLimit {
+	if limit, ok := c.PoolEndPointRateLimits[address]; ok {
+		return limit
+	}
+	return EndPointRateLimit{
+		RequestsPerSecond: c.PoolEndPointRps,
+		MaxInFlight:       c.PoolEndPointMaxInFlight,
+	}
+}
+
+// parse rate limits of end points, format: url=rps/maxInFlight,url=rps/maxInFlight
+func parseEndPointRateLimits(v string) (map[string]EndPointRateLimit, error) {
+	limits := make(map[string]EndPointRateLimit)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %v", item)
+		}
+		values := strings.Split(item[i+1:], "/")
+		if len(values) != 2 {
+			return nil, fmt.Errorf("invalid rate limit %v", item)
+		}
+		rps, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		maxInFlight, err := strconv.Atoi(values[1])
+		if err != nil {
+			return nil, err
+		}
+		limits[item[:i]] = EndPointRateLimit{
+			RequestsPerSecond: rps,
+			MaxInFlight:       maxInFlight,
+		}
+	}
+	return limits, nil
+}
+
+// parse max attempts of error kinds, format: kind=attempts,kind=attempts
+func parseRetryKindMaxAttempts(v string) (map[string]int, error) {
+	attempts := make(map[string]int)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.Split(item, "=")
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid kind max attempts %v", item)
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid max attempts of kind %v", item)
+		}
+		attempts[kv[0]] = n
+	}
+	return attempts, nil
+}
@@ -0,0 +1,33 @@
+package conf
+
+import "testing"
+
+func TestParseEndPointRateLimits(t *testing.T) {
+	limits, err := parseEndPointRateLimits("tcp://127.0.0.1:26657=50/20, tcp://127.0.0.2:26657=0.5/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := limits["tcp://127.0.0.1:26657"]; v.RequestsPerSecond != 50 || v.MaxInFlight != 20 {
+		t.Fatalf("unexpected limit %+v", v)
+	}
+	if v := limits["tcp://127.0.0.2:26657"]; v.RequestsPerSecond != 0.5 || v.MaxInFlight != 1 {
+		t.Fatalf("unexpected limit %+v", v)
+	}
+
+	if _, err := parseEndPointRateLimits("tcp://127.0.0.1:26657=50"); err == nil {
+		t.Fatal("rate limit without max in flight should be invalid")
+	}
+}
+
+func TestParseRetryKindMaxAttempts(t *testing.T) {
+	attempts, err := parseRetryKindMaxAttempts("rpc=5, txn_conflict=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts["rpc"] != 5 || attempts["txn_conflict"] != 1 {
+		t.Fatalf("unexpected attempts %v", attempts)
+	}
+	if _, err := parseRetryKindMaxAttempts("rpc"); err == nil {
+		t.Fatal("kind without attempts should be invalid")
+	}
+}
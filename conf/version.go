@@ -0,0 +1,4 @@
+package conf
+
+// version of binary, it's set by -ldflags "-X github.com/irisnet/rainbow-sync/conf.Version=<version>" when built by make
+var Version = "dev"
@@ -5,6 +5,9 @@ const (
 	SyncTaskStatusUnHandled = "unhandled"
 	SyncTaskStatusUnderway  = "underway"
 	SyncTaskStatusCompleted = "completed"
+	// task of single height which is quarantined after it keeps failing,
+	// it's set unhandled again by retry-quarantined command
+	SyncTaskStatusFailed = "failed"
 
 	// only for follow task
 	// when current_height of follow task add blockNumPerWorkerHandle
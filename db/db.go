@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	conf "github.com/irisnet/rainbow-sync/conf/db"
 	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/lib/retry"
+	"github.com/irisnet/rainbow-sync/utils"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/mgo.v2/txn"
@@ -46,20 +49,6 @@ func getSession() *mgo.Session {
 	return session.Clone()
 }
 
-func EnsureIndexes(collectionName string, indexes []mgo.Index) {
-	session := getSession()
-	defer session.Close()
-	c := session.DB(conf.Database).C(collectionName)
-	if len(indexes) > 0 {
-		for _, v := range indexes {
-			if err := c.EnsureIndex(v); err != nil {
-				logger.Warn("ensure index fail", logger.String("collectionName", collectionName),
-					logger.String("err", err.Error()))
-			}
-		}
-	}
-}
-
 // get collection object
 func ExecCollection(collectionName string, s func(*mgo.Collection) error) error {
 	session := getSession()
@@ -98,7 +87,8 @@ func Delete(h Docs) error {
 
 //mgo transaction method
 //detail to see: https://godoc.org/gopkg.in/mgo.v2/txn
-func Txn(ops []txn.Op) error {
+// retry of txn stops when ctx is done
+func Txn(ctx context.Context, ops []txn.Op) error {
 	session := getSession()
 	defer session.Close()
 
@@ -106,17 +96,37 @@ func Txn(ops []txn.Op) error {
 	runner := txn.NewRunner(c)
 
 	txObjectId := bson.NewObjectId()
-	err := runner.Run(ops, txObjectId, nil)
-	if err != nil {
-		if err == txn.ErrAborted {
-			err = runner.Resume(txObjectId)
+	return retry.Do(ctx, "db.Txn", retry.Default(), func(attempt int) error {
+		if attempt > 1 {
+			// txn may have been inserted by failed attempt, resume it instead of running ops again
+			n, err := c.FindId(txObjectId).Count()
 			if err != nil {
-				return err
+				return utils.WrapErr(utils.ErrKindDb, "db.Txn", err)
+			}
+			if n > 0 {
+				return txnErr(runner.Resume(txObjectId))
 			}
-		} else {
-			return err
 		}
-	}
+		err := runner.Run(ops, txObjectId, nil)
+		if err == txn.ErrAborted {
+			err = runner.Resume(txObjectId)
+		}
+		return txnErr(err)
+	})
+}
 
-	return nil
+// txn which is applied or removed by other runner can't be found in queue of doc,
+// it is distinguished from other db errors. aborted txn, whose assert fails, isn't retried
+func txnErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(err.Error(), utils.ErrDbNotFindTransaction) {
+		return utils.WrapErr(utils.ErrKindTxnConflict, "db.Txn", err)
+	}
+	e := utils.WrapErr(utils.ErrKindDb, "db.Txn", err)
+	if err == txn.ErrAborted {
+		e.Retryable = false
+	}
+	return e
 }
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"fmt"
+	conf "github.com/irisnet/rainbow-sync/conf/db"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+const (
+	defaultIndexName = "_id_"
+	// interval of reporting progress of index builds
+	indexProgressInterval = 10 * time.Second
+)
+
+type (
+	// result of comparing declared indexes with indexes in db
+	indexDiff struct {
+		missing []mgo.Index
+		extra   []mgo.Index
+		// indexes whose key is declared but options differ, declared index => existing one
+		changed []indexChange
+	}
+
+	indexChange struct {
+		declared mgo.Index
+		existing mgo.Index
+	}
+
+	indexBuildOp struct {
+		Ns       string `bson:"ns"`
+		Msg      string `bson:"msg"`
+		Progress struct {
+			Done  int64 `bson:"done"`
+			Total int64 `bson:"total"`
+		} `bson:"progress"`
+	}
+)
+
+// reconcile indexes declared by docs and extra indexes of config with indexes in db:
+// missing indexes are built in background, extra indexes and indexes whose options differ are reported,
+// and they are dropped if drop extra indexes is enabled, changed indexes are built again with declared options
+func ReconcileIndexes(docs []Docs) {
+	extraConf, err := parseIndexesConf(conf.ExtraIndexes)
+	if err != nil {
+		logger.Fatal("parse extra indexes fail", logger.String("err", err.Error()))
+	}
+	if err := checkIndexesConf(extraConf, docs); err != nil {
+		logger.Fatal("invalid extra indexes", logger.String("err", err.Error()))
+	}
+
+	var builds = make(map[string][]mgo.Index)
+	for _, doc := range docs {
+		declared := append(doc.Indexes(), extraConf[doc.Name()]...)
+		existing, err := listIndexes(doc.Name())
+		if err != nil {
+			logger.Error("list indexes fail", logger.String("collectionName", doc.Name()),
+				logger.String("err", err.Error()))
+			continue
+		}
+		diff := diffIndexes(declared, existing)
+		for _, v := range diff.extra {
+			if !conf.DropExtraIndexes {
+				logger.Warn("index isn't declared", logger.String("collectionName", doc.Name()),
+					logger.String("index", v.Name), logger.String("key", indexKey(v)))
+				continue
+			}
+			if err := dropIndex(doc.Name(), v.Name); err != nil {
+				logger.Error("drop index fail", logger.String("collectionName", doc.Name()),
+					logger.String("index", v.Name), logger.String("err", err.Error()))
+			} else {
+				logger.Info("drop index which isn't declared", logger.String("collectionName", doc.Name()),
+					logger.String("index", v.Name), logger.String("key", indexKey(v)))
+			}
+		}
+		for _, v := range diff.changed {
+			if !conf.DropExtraIndexes {
+				logger.Warn("options of index differ from declared", logger.String("collectionName", doc.Name()),
+					logger.String("index", v.existing.Name), logger.String("key", indexKey(v.existing)),
+					logger.String("declared", indexOptions(v.declared)), logger.String("existing", indexOptions(v.existing)))
+				continue
+			}
+			if err := dropIndex(doc.Name(), v.existing.Name); err != nil {
+				logger.Error("drop index fail", logger.String("collectionName", doc.Name()),
+					logger.String("index", v.existing.Name), logger.String("err", err.Error()))
+				continue
+			}
+			logger.Info("drop index whose options differ from declared", logger.String("collectionName", doc.Name()),
+				logger.String("index", v.existing.Name), logger.String("key", indexKey(v.existing)))
+			diff.missing = append(diff.missing, v.declared)
+		}
+		if len(diff.missing) > 0 {
+			builds[doc.Name()] = diff.missing
+		}
+	}
+	if len(builds) > 0 {
+		go buildIndexes(builds)
+	}
+}
+
+// build indexes one by one, and report progress of builds until all of them finished
+func buildIndexes(builds map[string][]mgo.Index) {
+	done := make(chan struct{})
+	go reportIndexProgress(done)
+	defer close(done)
+
+	for collectionName, indexes := range builds {
+		for _, v := range indexes {
+			begin := time.Now()
+			logger.Info("start build index", logger.String("collectionName", collectionName),
+				logger.String("key", indexKey(v)))
+			v.Background = true
+			err := ExecCollection(collectionName, func(c *mgo.Collection) error {
+				return c.EnsureIndex(v)
+			})
+			if err != nil {
+				logger.Error("build index fail", logger.String("collectionName", collectionName),
+					logger.String("key", indexKey(v)), logger.String("err", err.Error()))
+				continue
+			}
+			logger.Info("finish build index", logger.String("collectionName", collectionName),
+				logger.String("key", indexKey(v)), logger.String("cost", time.Since(begin).String()))
+		}
+	}
+}
+
+func reportIndexProgress(done chan struct{}) {
+	ticker := time.NewTicker(indexProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ops, err := currentIndexBuilds()
+			if err != nil {
+				// user may have no privilege to run currentOp
+				logger.Warn("get progress of index builds fail", logger.String("err", err.Error()))
+				return
+			}
+			for _, v := range ops {
+				logger.Info("index build in progress", logger.String("ns", v.Ns), logger.String("msg", v.Msg),
+					logger.Int64("done", v.Progress.Done), logger.Int64("total", v.Progress.Total))
+			}
+		}
+	}
+}
+
+func currentIndexBuilds() ([]indexBuildOp, error) {
+	session := getSession()
+	defer session.Close()
+	var res struct {
+		Inprog []indexBuildOp `bson:"inprog"`
+	}
+	cmd := bson.D{
+		{Name: "currentOp", Value: 1},
+		{Name: "$or", Value: []bson.M{
+			{"op": "command", "command.createIndexes": bson.M{"$exists": true}},
+			{"op": "none", "msg": bson.RegEx{Pattern: "^Index Build"}},
+		}},
+	}
+	err := session.DB("admin").Run(cmd, &res)
+	return res.Inprog, err
+}
+
+func listIndexes(collectionName string) ([]mgo.Index, error) {
+	var indexes []mgo.Index
+	err := ExecCollection(collectionName, func(c *mgo.Collection) error {
+		var err error
+		indexes, err = c.Indexes()
+		if err != nil && strings.Contains(err.Error(), "ns does not exist") {
+			// collection hasn't been created
+			return nil
+		}
+		return err
+	})
+	return indexes, err
+}
+
+func dropIndex(collectionName, name string) error {
+	return ExecCollection(collectionName, func(c *mgo.Collection) error {
+		return c.DropIndexName(name)
+	})
+}
+
+// indexes are matched by key, such as -height,-tx_index, and matched indexes are compared by unique and sparse
+func diffIndexes(declared, existing []mgo.Index) indexDiff {
+	var diff indexDiff
+	declaredKeys := make(map[string]bool, len(declared))
+	existingIndexes := make(map[string]mgo.Index, len(existing))
+	for _, v := range existing {
+		existingIndexes[indexKey(v)] = v
+	}
+	for _, v := range declared {
+		key := indexKey(v)
+		if declaredKeys[key] {
+			continue
+		}
+		declaredKeys[key] = true
+		e, ok := existingIndexes[key]
+		if !ok {
+			diff.missing = append(diff.missing, v)
+		} else if indexOptions(e) != indexOptions(v) {
+			diff.changed = append(diff.changed, indexChange{declared: v, existing: e})
+		}
+	}
+	for _, v := range existing {
+		if v.Name != defaultIndexName && !declaredKeys[indexKey(v)] {
+			diff.extra = append(diff.extra, v)
+		}
+	}
+	return diff
+}
+
+func indexKey(index mgo.Index) string {
+	return strings.Join(index.Key, ",")
+}
+
+func indexOptions(index mgo.Index) string {
+	return fmt.Sprintf("unique=%v,sparse=%v", index.Unique, index.Sparse)
+}
+
+// extra indexes of config should belong to collections of docs, or they are never built
+func checkIndexesConf(indexes map[string][]mgo.Index, docs []Docs) error {
+	names := make(map[string]bool, len(docs))
+	for _, v := range docs {
+		names[v.Name()] = true
+	}
+	for name := range indexes {
+		if !names[name] {
+			return fmt.Errorf("unknown collection %v", name)
+		}
+	}
+	return nil
+}
+
+// parse indexes of config, format: collection:key1,-key2;collection:key1
+func parseIndexesConf(s string) (map[string][]mgo.Index, error) {
+	indexes := make(map[string][]mgo.Index)
+	for _, v := range strings.Split(s, ";") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid index %v", v)
+		}
+		var key []string
+		for _, field := range strings.Split(parts[1], ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				return nil, fmt.Errorf("invalid index %v", v)
+			}
+			key = append(key, field)
+		}
+		indexes[parts[0]] = append(indexes[parts[0]], mgo.Index{Key: key, Background: true})
+	}
+	return indexes, nil
+}
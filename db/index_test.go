@@ -0,0 +1,64 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"testing"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	declared := []mgo.Index{
+		{Key: []string{"-height", "-tx_index"}, Unique: true},
+		{Key: []string{"addrs", "-tx_id"}},
+		{Key: []string{"addrs", "-tx_id"}},
+		{Key: []string{"-tx_hash"}, Unique: true},
+	}
+	existing := []mgo.Index{
+		{Name: "_id_", Key: []string{"_id"}},
+		{Name: "height_-1_tx_index_-1", Key: []string{"-height", "-tx_index"}, Unique: true},
+		{Name: "memo_1", Key: []string{"memo"}},
+		{Name: "tx_hash_-1", Key: []string{"-tx_hash"}, Sparse: true},
+	}
+	diff := diffIndexes(declared, existing)
+	if len(diff.missing) != 1 || indexKey(diff.missing[0]) != "addrs,-tx_id" {
+		t.Errorf("unexpected missing indexes %v", diff.missing)
+	}
+	if len(diff.extra) != 1 || diff.extra[0].Name != "memo_1" {
+		t.Errorf("unexpected extra indexes %v", diff.extra)
+	}
+	if len(diff.changed) != 1 || diff.changed[0].existing.Name != "tx_hash_-1" || !diff.changed[0].declared.Unique {
+		t.Errorf("index whose options differ should be changed, got %v", diff.changed)
+	}
+}
+
+type testDocs string
+
+func (d testDocs) Name() string                     { return string(d) }
+func (d testDocs) PkKvPair() map[string]interface{} { return nil }
+func (d testDocs) Indexes() []mgo.Index             { return nil }
+
+func TestCheckIndexesConf(t *testing.T) {
+	docs := []Docs{testDocs("sync_iris_tx"), testDocs("sync_iris_tx_msg")}
+	indexes, _ := parseIndexesConf("sync_iris_tx:memo;sync_iris_tx_msg:type,-time")
+	if err := checkIndexesConf(indexes, docs); err != nil {
+		t.Error(err)
+	}
+	indexes, _ = parseIndexesConf("sync_iris_txs:memo")
+	if err := checkIndexesConf(indexes, docs); err == nil {
+		t.Error("index of unknown collection should be invalid")
+	}
+}
+
+func TestParseIndexesConf(t *testing.T) {
+	indexes, err := parseIndexesConf("sync_iris_tx:memo; sync_iris_tx_msg:type,-time;sync_iris_tx:-fee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes["sync_iris_tx"]) != 2 || indexKey(indexes["sync_iris_tx_msg"][0]) != "type,-time" {
+		t.Errorf("unexpected indexes %v", indexes)
+	}
+	for _, v := range []string{"sync_iris_tx", "sync_iris_tx:", ":memo", "sync_iris_tx:memo,"} {
+		if _, err := parseIndexesConf(v); err == nil {
+			t.Errorf("%q should be invalid", v)
+		}
+	}
+}
@@ -2,6 +2,8 @@
 
 package db
 
+import "gopkg.in/mgo.v2"
+
 const (
 	CollectionNameTxn = "sync_mgo_txn"
 )
@@ -12,7 +14,7 @@ type (
 		Name() string
 		// primary key pair(used to find a unique record)
 		PkKvPair() map[string]interface{}
-		// ensure indexes
-		EnsureIndexes()
+		// indexes of collection, they are reconciled with db on startup
+		Indexes() []mgo.Index
 	}
 )
@@ -0,0 +1,83 @@
+// change feed of tx msgs, only msgs below contiguous committed watermark are exposed,
+// so that consumer reads every msg exactly once in height order
+
+package feed
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/model"
+	"strings"
+)
+
+const cursorVersion = "v1."
+
+type (
+	Page struct {
+		Msgs []model.TxMsg `json:"msgs"`
+		// cursor to read next page, it's returned even if page is empty
+		Next      string `json:"next"`
+		Watermark int64  `json:"watermark"`
+	}
+
+	// cursor is position of last msg read by consumer
+	cursor struct {
+		Height   int64  `json:"h"`
+		TxIndex  uint32 `json:"t"`
+		MsgIndex int    `json:"m"`
+	}
+)
+
+// read msgs after cursor, empty cursor reads from msgs of fromHeight
+func Read(c string, fromHeight int64, limit int) (Page, error) {
+	var after *model.MsgPosition
+	if c != "" {
+		p, err := decodeCursor(c)
+		if err != nil {
+			return Page{}, err
+		}
+		after = p
+	} else if fromHeight > 0 {
+		// position after all msgs of fromHeight-1
+		after = &model.MsgPosition{Height: fromHeight - 1, TxIndex: ^uint32(0), MsgIndex: int(^uint(0) >> 1)}
+	}
+
+	height, err := Watermark()
+	if err != nil {
+		return Page{}, err
+	}
+	msgs, err := new(model.TxMsg).QueryMsgsAfter(after, height, limit)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Msgs: msgs, Next: c, Watermark: height}
+	if len(msgs) > 0 {
+		last := msgs[len(msgs)-1]
+		page.Next = encodeCursor(model.MsgPosition{Height: last.Height, TxIndex: last.TxIndex, MsgIndex: last.MsgIndex})
+	} else if after != nil {
+		page.Next = encodeCursor(*after)
+	}
+	return page, nil
+}
+
+func encodeCursor(p model.MsgPosition) string {
+	data, _ := json.Marshal(cursor{Height: p.Height, TxIndex: p.TxIndex, MsgIndex: p.MsgIndex})
+	return cursorVersion + base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*model.MsgPosition, error) {
+	if !strings.HasPrefix(s, cursorVersion) {
+		return nil, fmt.Errorf("invalid cursor %v", s)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, cursorVersion))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %v", s)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor %v", s)
+	}
+	return &model.MsgPosition{Height: c.Height, TxIndex: c.TxIndex, MsgIndex: c.MsgIndex}, nil
+}
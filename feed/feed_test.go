@@ -0,0 +1,51 @@
+package feed
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/model"
+	"testing"
+)
+
+func TestAdvanceWatermark(t *testing.T) {
+	tasks := []model.SyncTask{
+		{StartHeight: 101, EndHeight: 150, CurrentHeight: 120, Status: db.SyncTaskStatusUnderway},
+		{StartHeight: 1, EndHeight: 50, CurrentHeight: 50, Status: db.SyncTaskStatusCompleted},
+		// invalid follow task has committed heights up to current height
+		{StartHeight: 51, EndHeight: 0, CurrentHeight: 80, Status: db.FollowTaskStatusInvalid},
+		{StartHeight: 81, EndHeight: 100, CurrentHeight: 0, Status: db.SyncTaskStatusUnHandled},
+		{StartHeight: 151, EndHeight: 0, CurrentHeight: 160, Status: db.SyncTaskStatusUnderway},
+	}
+	if h := advanceWatermark(0, tasks); h != 80 {
+		t.Fatalf("watermark should stop before unhandled task, got %v", h)
+	}
+
+	tasks[3].CurrentHeight, tasks[3].Status = 100, db.SyncTaskStatusCompleted
+	if h := advanceWatermark(80, tasks); h != 120 {
+		t.Fatalf("watermark should stop at current height of underway task, got %v", h)
+	}
+	if h := advanceWatermark(130, nil); h != 130 {
+		t.Fatalf("watermark shouldn't go back, got %v", h)
+	}
+
+	// height 90 is quarantined, task 81-100 skipped it
+	tasks = append(tasks, model.SyncTask{StartHeight: 90, EndHeight: 90, Status: db.SyncTaskStatusFailed})
+	if h := advanceWatermark(80, tasks); h != 89 {
+		t.Fatalf("watermark should stop before quarantined height, got %v", h)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	p := model.MsgPosition{Height: 990, TxIndex: 3, MsgIndex: 2}
+	got, err := decodeCursor(encodeCursor(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != p {
+		t.Fatalf("got %+v, want %+v", *got, p)
+	}
+	for _, v := range []string{"990-3-2", "v1.!!", "v1." + "bm90IGpzb24"} {
+		if _, err := decodeCursor(v); err == nil {
+			t.Errorf("cursor %q should be invalid", v)
+		}
+	}
+}
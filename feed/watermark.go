@@ -0,0 +1,122 @@
+package feed
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watermark is refreshed at most once in interval
+const watermarkRefreshInterval = time.Second
+
+// committed watermark is the max height which all heights below it have been committed,
+// tasks which end below it won't change, so only tasks above it are loaded on refresh
+type watermark struct {
+	mu          sync.Mutex
+	height      int64
+	initialized bool
+	refreshTime time.Time
+}
+
+var committed watermark
+
+// get contiguous committed watermark
+func Watermark() (int64, error) {
+	return committed.get()
+}
+
+func (w *watermark) get() (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.refreshTime) < watermarkRefreshInterval {
+		return w.height, nil
+	}
+
+	tasks, err := queryTasksAbove(w.height)
+	if err != nil {
+		return w.height, err
+	}
+	if !w.initialized && len(tasks) > 0 {
+		// sync may start from height specified by first task rather than 1
+		w.height = minStartHeight(tasks) - 1
+		w.initialized = true
+	}
+	w.height = advanceWatermark(w.height, tasks)
+	w.refreshTime = time.Now()
+	return w.height, nil
+}
+
+// tasks which may hold heights above height, follow tasks have no end height
+func queryTasksAbove(height int64) ([]imodel.SyncTask, error) {
+	var tasks []imodel.SyncTask
+	q := bson.M{
+		"$or": []bson.M{
+			{"end_height": 0},
+			{"end_height": bson.M{"$gt": height}},
+		},
+	}
+	fn := func(c *mgo.Collection) error {
+		return c.Find(q).Select(bson.M{"start_height": 1, "end_height": 1, "current_height": 1, "status": 1}).All(&tasks)
+	}
+	err := db.ExecCollection(imodel.CollectionNameSyncTask, fn)
+	return tasks, err
+}
+
+func minStartHeight(tasks []imodel.SyncTask) int64 {
+	min := tasks[0].StartHeight
+	for _, v := range tasks {
+		if v.StartHeight < min {
+			min = v.StartHeight
+		}
+	}
+	return min
+}
+
+// advance watermark over heights committed by tasks until the first gap,
+// heights of task are committed from start height to current height, or to end height if completed.
+// watermark doesn't go beyond uncommitted heights of unfinished tasks, such as failed task of quarantined height
+// whose height is skipped by its owning task
+func advanceWatermark(height int64, tasks []imodel.SyncTask) int64 {
+	origin := height
+	limit := int64(-1)
+	sorted := make([]imodel.SyncTask, len(tasks))
+	copy(sorted, tasks)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].StartHeight < sorted[j].StartHeight
+	})
+	for _, v := range sorted {
+		if v.StartHeight > height+1 {
+			break
+		}
+		committedHeight := v.CurrentHeight
+		if v.Status == db.SyncTaskStatusCompleted && v.EndHeight > 0 {
+			committedHeight = v.EndHeight
+		}
+		if committedHeight > height {
+			height = committedHeight
+		}
+	}
+	for _, v := range tasks {
+		switch v.Status {
+		case db.SyncTaskStatusUnHandled, db.SyncTaskStatusUnderway, db.SyncTaskStatusFailed:
+			committedHeight := v.CurrentHeight
+			if committedHeight < v.StartHeight-1 {
+				committedHeight = v.StartHeight - 1
+			}
+			if limit < 0 || committedHeight < limit {
+				limit = committedHeight
+			}
+		}
+	}
+	if limit >= 0 && height > limit {
+		height = limit
+	}
+	if height < origin {
+		return origin
+	}
+	return height
+}
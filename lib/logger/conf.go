@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// env of logger are read here instead of conf, because conf depends on logger
+const (
+	EnvNameLogLevel      = "LOG_LEVEL"
+	EnvNameLogFormat     = "LOG_FORMAT"
+	EnvNameLogOutputs    = "LOG_OUTPUTS"
+	EnvNameLogFile       = "LOG_FILE"
+	EnvNameLogMaxSize    = "LOG_MAX_SIZE"
+	EnvNameLogMaxBackups = "LOG_MAX_BACKUPS"
+	EnvNameLogMaxAge     = "LOG_MAX_AGE"
+	EnvNameLogCompress   = "LOG_COMPRESS"
+	EnvNameLogLevelPort  = "LOG_LEVEL_PORT"
+)
+
+const (
+	FormatJson    = "json"
+	FormatConsole = "console"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+)
+
+type Conf struct {
+	Level      zapcore.Level
+	Format     string
+	Outputs    []string
+	File       string
+	MaxSize    int // megabytes
+	MaxBackups int
+	MaxAge     int // days
+	Compress   bool
+	LevelPort  int // endpoint of changing level is disabled when port is 0
+}
+
+func defaultConf() Conf {
+	return Conf{
+		Level:      zapcore.DebugLevel,
+		Format:     FormatJson,
+		Outputs:    []string{OutputStdout, OutputFile},
+		File:       "./logs/sync.log",
+		MaxSize:    100,
+		MaxBackups: 3,
+		MaxAge:     7,
+		Compress:   true,
+	}
+}
+
+// read conf of logger from env, unset env keeps default value
+func loadConf(lookupEnv func(string) (string, bool)) (Conf, error) {
+	c := defaultConf()
+	if v, found := lookupEnv(EnvNameLogLevel); found {
+		if err := c.Level.UnmarshalText([]byte(v)); err != nil {
+			return c, fmt.Errorf("invalid %v %v", EnvNameLogLevel, v)
+		}
+	}
+	if v, found := lookupEnv(EnvNameLogFormat); found {
+		if v != FormatJson && v != FormatConsole {
+			return c, fmt.Errorf("invalid %v %v, should be %v or %v", EnvNameLogFormat, v, FormatJson, FormatConsole)
+		}
+		c.Format = v
+	}
+	if v, found := lookupEnv(EnvNameLogOutputs); found {
+		c.Outputs = nil
+		for _, output := range strings.Split(v, ",") {
+			output = strings.TrimSpace(output)
+			switch output {
+			case OutputStdout, OutputStderr, OutputFile:
+				c.Outputs = append(c.Outputs, output)
+			case "":
+			default:
+				return c, fmt.Errorf("invalid output %v of %v", output, EnvNameLogOutputs)
+			}
+		}
+		if len(c.Outputs) == 0 {
+			return c, fmt.Errorf("%v shouldn't be empty", EnvNameLogOutputs)
+		}
+	}
+	if v, found := lookupEnv(EnvNameLogFile); found {
+		c.File = v
+	}
+	for env, value := range map[string]*int{
+		EnvNameLogMaxSize:    &c.MaxSize,
+		EnvNameLogMaxBackups: &c.MaxBackups,
+		EnvNameLogMaxAge:     &c.MaxAge,
+		EnvNameLogLevelPort:  &c.LevelPort,
+	} {
+		if v, found := lookupEnv(env); found {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return c, fmt.Errorf("invalid %v %v", env, v)
+			}
+			*value = n
+		}
+	}
+	if v, found := lookupEnv(EnvNameLogCompress); found {
+		compress, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid %v %v", EnvNameLogCompress, v)
+		}
+		c.Compress = compress
+	}
+
+	return c, nil
+}
+
+func loadEnvConf() Conf {
+	c, err := loadConf(os.LookupEnv)
+	if err != nil {
+		// logger isn't available yet
+		fmt.Fprintln(os.Stderr, "init logger fail:", err)
+		os.Exit(1)
+	}
+	return c
+}
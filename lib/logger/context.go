@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+// logger carrying fields, which are added to every line it emits
+type Logger struct {
+	l *zap.Logger
+}
+
+type ctxKey struct{}
+
+// new logger with fields added to lines of global logger
+func With(fields ...Field) *Logger {
+	return &Logger{l: zapLogger.With(fields...)}
+}
+
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{l: l.l.With(fields...)}
+}
+
+func (l *Logger) Debug(msg string, fields ...Field) {
+	defer l.sync()
+	l.l.Debug(msg, fields...)
+}
+
+func (l *Logger) Info(msg string, fields ...Field) {
+	defer l.sync()
+	l.l.Info(msg, fields...)
+}
+
+func (l *Logger) Warn(msg string, fields ...Field) {
+	defer l.sync()
+	l.l.Warn(msg, fields...)
+}
+
+func (l *Logger) Error(msg string, fields ...Field) {
+	defer l.sync()
+	l.l.Error(msg, fields...)
+}
+
+func (l *Logger) sync() {
+	l.l.Sync()
+}
+
+// bind logger to ctx, lines emitted by FromContext(ctx) carry its fields
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// logger bound to ctx, or global logger if there is none
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return &Logger{l: zapLogger}
+}
@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const levelPath = "/log/level"
+
+// serve endpoint of logger level, GET returns current level and
+// PUT with body {"level":"info"} changes level of all outputs at runtime.
+// endpoint is disabled when LOG_LEVEL_PORT is 0
+func StartLevelServer() {
+	if levelPort == 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(levelPath, level)
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%v", levelPort),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	Info("Start log level server", Int("port", levelPort), String("path", levelPath))
+	if err := srv.ListenAndServe(); err != nil {
+		Error("log level server exit", String("err", err.Error()))
+	}
+}
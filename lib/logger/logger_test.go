@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConf(t *testing.T) {
+	env := map[string]string{
+		EnvNameLogLevel:     "warn",
+		EnvNameLogFormat:    FormatConsole,
+		EnvNameLogOutputs:   "stderr, file",
+		EnvNameLogMaxSize:   "10",
+		EnvNameLogCompress:  "false",
+		EnvNameLogLevelPort: "9091",
+	}
+	c, err := loadConf(func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultConf()
+	want.Level, want.Format, want.Outputs = zapcore.WarnLevel, FormatConsole, []string{OutputStderr, OutputFile}
+	want.MaxSize, want.Compress, want.LevelPort = 10, false, 9091
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("got %+v, want %+v", c, want)
+	}
+
+	for k, v := range map[string]string{
+		EnvNameLogLevel:   "verbose",
+		EnvNameLogFormat:  "xml",
+		EnvNameLogOutputs: "stdout,syslog",
+		EnvNameLogMaxAge:  "-1",
+	} {
+		if _, err := loadConf(func(key string) (string, bool) { return v, key == k }); err == nil {
+			t.Errorf("%v=%v should be invalid", k, v)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	origin := zapLogger
+	zapLogger = zap.New(core)
+	defer func() { zapLogger = origin }()
+
+	FromContext(context.Background()).Info("no fields")
+	ctx := NewContext(context.Background(), With(String("taskId", "t1")).With(Int64("height", 7)))
+	FromContext(ctx).Warn("with fields", String("txhash", "AB"))
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 || len(entries[0].Context) != 0 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if got := entries[1].ContextMap(); got["taskId"] != "t1" || got["height"] != int64(7) || got["txhash"] != "AB" {
+		t.Fatalf("unexpected fields %v", got)
+	}
+}
+
+func TestChangeLevel(t *testing.T) {
+	defer level.SetLevel(level.Level())
+	req := httptest.NewRequest(http.MethodPut, levelPath, strings.NewReader(`{"level":"error"}`))
+	w := httptest.NewRecorder()
+	level.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v, body %v", w.Code, w.Body.String())
+	}
+	if zapLogger.Core().Enabled(zapcore.WarnLevel) || !zapLogger.Core().Enabled(zapcore.ErrorLevel) {
+		t.Fatal("level of logger should be changed to error")
+	}
+}
@@ -13,6 +13,10 @@ type (
 
 var (
 	zapLogger *zap.Logger
+	// level of logger, it can be changed at runtime by level endpoint
+	level = zap.NewAtomicLevel()
+	// port of level endpoint, set by LOG_LEVEL_PORT
+	levelPort int
 
 	// zap method
 	Binary     = zap.Binary
@@ -67,48 +71,55 @@ func Fatal(msg string, fields ...Field) {
 	zapLogger.Fatal(msg, fields...)
 }
 
-func With(fields ...Field) {
-	defer sync()
-	zapLogger.With(fields...)
-}
-
 func sync() {
 	zapLogger.Sync()
 }
 
 func init() {
-	var core zapcore.Core
-	hook := lumberjack.Logger{
-		Filename:   "./logs/sync.log",
-		MaxSize:    100, // megabytes
-		MaxBackups: 3,
-		MaxAge:     7,    //days
-		Compress:   true, // disabled by default
-		LocalTime:  true,
-	}
-
-	fileWriter := zapcore.AddSync(&hook)
-	consoleDebugging := zapcore.Lock(os.Stdout)
+	conf := loadEnvConf()
+	level.SetLevel(conf.Level)
+	levelPort = conf.LevelPort
+	zapLogger = newZapLogger(conf)
+}
 
+// build logger writing to outputs of conf, level of all outputs is changed by level at runtime
+func newZapLogger(conf Conf) *zap.Logger {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoder := zapcore.NewJSONEncoder(encoderConfig)
+	var encoder zapcore.Encoder
+	if conf.Format == FormatConsole {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
 
-	// Join the outputs, encoders, and level-handling functions into
-	// zapcore.Cores, then tee the four cores together.
-	highPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.InfoLevel
-	})
-	lowPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.DebugLevel
+	// debug lines are written to console only
+	fileLevel := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
+		return lvl >= zapcore.InfoLevel && level.Enabled(lvl)
 	})
 
-	core = zapcore.NewTee(
-		zapcore.NewCore(encoder, consoleDebugging, lowPriority),
-		zapcore.NewCore(encoder, fileWriter, highPriority),
-	)
+	cores := make([]zapcore.Core, 0, len(conf.Outputs))
+	for _, output := range conf.Outputs {
+		switch output {
+		case OutputStdout:
+			cores = append(cores, zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), level))
+		case OutputStderr:
+			cores = append(cores, zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), level))
+		case OutputFile:
+			hook := lumberjack.Logger{
+				Filename:   conf.File,
+				MaxSize:    conf.MaxSize,
+				MaxBackups: conf.MaxBackups,
+				MaxAge:     conf.MaxAge,
+				Compress:   conf.Compress,
+				LocalTime:  true,
+			}
+			cores = append(cores, zapcore.NewCore(encoder, zapcore.AddSync(&hook), fileLevel))
+		}
+	}
+
 	caller := zap.AddCaller()
 	callerSkipOpt := zap.AddCallerSkip(1)
-	// From a zapcore.Core, it's easy to construct a Logger.
-	zapLogger = zap.New(core, caller, callerSkipOpt, zap.AddStacktrace(zap.ErrorLevel))
+	return zap.New(zapcore.NewTee(cores...), caller, callerSkipOpt, zap.AddStacktrace(zap.ErrorLevel))
 }
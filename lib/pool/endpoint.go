@@ -0,0 +1,206 @@
+package pool
+
+import (
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// state of endpoint circuit breaker
+const (
+	// endpoint is healthy, requests pass through
+	EndPointStateClosed = 0
+	// endpoint has been probed after open duration, only one client is made for probing
+	EndPointStateHalfOpen = 1
+	// endpoint failed too many times in a row, it is removed from rotation
+	EndPointStateOpen = 2
+
+	defaultLatency   = 100 * time.Millisecond
+	latencySmoothing = 0.2
+)
+
+type (
+	// snapshot of endpoint health
+	EndPoint struct {
+		Address             string
+		Available           bool
+		State               int
+		ConsecutiveFailures int
+		Latency             time.Duration
+		LatestHeight        int64
+		EarliestHeight      int64 // earliest block height which endpoint still holds, 0 when unknown
+	}
+
+	endPointHealth struct {
+		mu       sync.Mutex
+		endPoint EndPoint
+		openedAt time.Time
+		probing  bool
+		limiter  *rateLimiter
+	}
+)
+
+func newEndPointHealth(address string) *endPointHealth {
+	limit := conf.SvrConf.GetEndPointRateLimit(address)
+	return &endPointHealth{
+		endPoint: EndPoint{
+			Address:   address,
+			Available: true,
+			State:     EndPointStateClosed,
+		},
+		limiter: newRateLimiter(limit.RequestsPerSecond, limit.MaxInFlight),
+	}
+}
+
+func (e *endPointHealth) snapshot() EndPoint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.endPoint
+}
+
+// record a successful request and its latency,
+// a half open endpoint will be closed after success
+func (e *endPointHealth) recordSuccess(latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.endPoint.Latency == 0 {
+		e.endPoint.Latency = latency
+	} else {
+		e.endPoint.Latency = time.Duration((1-latencySmoothing)*float64(e.endPoint.Latency) +
+			latencySmoothing*float64(latency))
+	}
+	e.endPoint.ConsecutiveFailures = 0
+	e.probing = false
+	if e.endPoint.State != EndPointStateClosed {
+		logger.Info("end point circuit closed", logger.String("address", e.endPoint.Address))
+		e.setState(EndPointStateClosed)
+	}
+}
+
+// record a failed request, endpoint will be open if it fails
+// PoolBreakerFailureThreshold times in a row or fails during half open probing
+func (e *endPointHealth) recordFailure() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.endPoint.ConsecutiveFailures++
+	e.probing = false
+	if e.endPoint.State == EndPointStateHalfOpen ||
+		e.endPoint.ConsecutiveFailures >= conf.SvrConf.PoolBreakerFailureThreshold {
+		if e.endPoint.State != EndPointStateOpen {
+			logger.Warn("end point circuit open", logger.String("address", e.endPoint.Address),
+				logger.Int("consecutiveFailures", e.endPoint.ConsecutiveFailures))
+		}
+		e.openedAt = time.Now()
+		e.setState(EndPointStateOpen)
+	}
+}
+
+func (e *endPointHealth) openedTime() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.openedAt
+}
+
+func (e *endPointHealth) recordHeights(earliestHeight, latestHeight int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.endPoint.EarliestHeight = earliestHeight
+	e.endPoint.LatestHeight = latestHeight
+}
+
+// whether endpoint holds block of height, endpoint whose earliest height
+// is unknown is regarded as holding it until it is validated
+func (e EndPoint) CanServe(height int64) bool {
+	return height <= 0 || e.EarliestHeight <= height
+}
+
+func (e *endPointHealth) setState(state int) {
+	e.endPoint.State = state
+	e.endPoint.Available = state != EndPointStateOpen
+}
+
+// whether endpoint can be selected, it doesn't change endpoint state
+func (e *endPointHealth) selectable() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch e.endPoint.State {
+	case EndPointStateClosed:
+		return true
+	case EndPointStateOpen:
+		openDuration := time.Duration(conf.SvrConf.PoolBreakerOpenSeconds) * time.Second
+		return time.Since(e.openedAt) >= openDuration
+	case EndPointStateHalfOpen:
+		return !e.probing
+	}
+	return false
+}
+
+// whether a new client can be made on this endpoint,
+// an open endpoint turns to half open after PoolBreakerOpenSeconds and allows one probe
+func (e *endPointHealth) acquire() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch e.endPoint.State {
+	case EndPointStateClosed:
+		return true
+	case EndPointStateOpen:
+		openDuration := time.Duration(conf.SvrConf.PoolBreakerOpenSeconds) * time.Second
+		if time.Since(e.openedAt) < openDuration {
+			return false
+		}
+		logger.Info("end point circuit half open", logger.String("address", e.endPoint.Address))
+		e.setState(EndPointStateHalfOpen)
+		e.probing = true
+		return true
+	case EndPointStateHalfOpen:
+		if e.probing {
+			return false
+		}
+		e.probing = true
+		return true
+	}
+	return false
+}
+
+// weight of endpoint in selection, lower latency and
+// fresher height get higher weight
+func (e EndPoint) weight(bestHeight int64) float64 {
+	latency := e.Latency
+	if latency <= 0 {
+		latency = defaultLatency
+	}
+	w := float64(time.Second) / float64(latency)
+	if lag := bestHeight - e.LatestHeight; e.LatestHeight > 0 && lag > 0 {
+		w = w / float64(1+lag)
+	}
+	return w
+}
+
+// select a endpoint weighted by latency and height freshness
+func selectWeighted(endPoints []EndPoint) int {
+	var (
+		bestHeight int64
+		total      float64
+	)
+	for _, v := range endPoints {
+		if v.LatestHeight > bestHeight {
+			bestHeight = v.LatestHeight
+		}
+	}
+	weights := make([]float64, len(endPoints))
+	for i, v := range endPoints {
+		weights[i] = v.weight(bestHeight)
+		total += weights[i]
+	}
+
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return len(endPoints) - 1
+}
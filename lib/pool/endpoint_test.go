@@ -0,0 +1,114 @@
+package pool
+
+import (
+	"context"
+	"github.com/irisnet/rainbow-sync/conf"
+	"testing"
+	"time"
+)
+
+func TestEndPointHealth_CircuitBreaker(t *testing.T) {
+	conf.SvrConf.PoolBreakerFailureThreshold = 2
+	conf.SvrConf.PoolBreakerOpenSeconds = 0
+	e := newEndPointHealth("tcp://127.0.0.1:26657")
+
+	e.recordFailure()
+	if e.snapshot().State != EndPointStateClosed {
+		t.Fatal("end point should be closed before reaching failure threshold")
+	}
+	e.recordFailure()
+	if e.snapshot().State != EndPointStateOpen || e.snapshot().Available {
+		t.Fatal("end point should be open after reaching failure threshold")
+	}
+
+	// open duration is 0, only one probe is allowed in half open state
+	if !e.acquire() || e.snapshot().State != EndPointStateHalfOpen {
+		t.Fatal("end point should be half open after open duration")
+	}
+	if e.selectable() || e.acquire() {
+		t.Fatal("end point shouldn't be selected when probing")
+	}
+	e.recordFailure()
+	if e.snapshot().State != EndPointStateOpen {
+		t.Fatal("end point should be open again when probe failed")
+	}
+
+	e.acquire()
+	e.recordSuccess(10 * time.Millisecond)
+	if s := e.snapshot(); s.State != EndPointStateClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("end point should be closed when probe succeeded, %+v", s)
+	}
+}
+
+func TestSelectWeighted(t *testing.T) {
+	endPoints := []EndPoint{
+		{Address: "fast", Latency: 10 * time.Millisecond, LatestHeight: 100},
+		{Address: "slow", Latency: 1000 * time.Millisecond, LatestHeight: 100},
+		{Address: "stale", Latency: 10 * time.Millisecond, LatestHeight: 1},
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[endPoints[selectWeighted(endPoints)].Address]++
+	}
+	if counts["fast"] < counts["slow"] || counts["fast"] < counts["stale"] {
+		t.Fatalf("fast and fresh end point should be selected most, %v", counts)
+	}
+}
+
+func TestEndPoint_CanServe(t *testing.T) {
+	e := EndPoint{EarliestHeight: 100}
+	if e.CanServe(99) || !e.CanServe(100) {
+		t.Fatal("pruned end point can only serve height >= earliest height")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(10, 1)
+	ctx := context.Background()
+
+	begin := time.Now()
+	for i := 0; i < 15; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		l.release()
+	}
+	// burst is 10, the other 5 requests wait 0.1s each
+	if d := time.Since(begin); d < 400*time.Millisecond {
+		t.Fatalf("requests should be slowed down by rate limiter, cost %v", d)
+	}
+
+	// in flight request blocks the next one until it is released
+	l = newRateLimiter(0, 1)
+	l.wait(ctx)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := l.wait(timeoutCtx); err == nil {
+		t.Fatal("request should wait until in flight request released")
+	}
+}
+
+func TestPoolFactory_GetEndPoint(t *testing.T) {
+	conf.SvrConf.PoolBreakerFailureThreshold = 1
+	conf.SvrConf.PoolBreakerOpenSeconds = 60
+	pruned, archive := newEndPointHealth("tcp://pruned:26657"), newEndPointHealth("tcp://archive:26657")
+	pruned.recordHeights(1000, 2000)
+	archive.recordHeights(1, 2000)
+	f := &PoolFactory{}
+	f.peersMap.Store(generateId("pruned"), pruned)
+	f.peersMap.Store(generateId("archive"), archive)
+
+	if e := f.GetEndPoint(10); e != archive {
+		t.Fatal("end point holding the height should be selected")
+	}
+	// all end points are open, fallback should still hold the height
+	archive.recordFailure()
+	pruned.recordFailure()
+	if e := f.GetEndPoint(10); e != archive {
+		t.Fatal("fallback end point should hold the height")
+	}
+	archive.recordHeights(500, 2000)
+	if e := f.GetEndPoint(10); e != nil {
+		t.Fatal("no end point should be returned when all of them have pruned the height")
+	}
+}
@@ -0,0 +1,242 @@
+package pool
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/conf"
+	rpcClient "github.com/tendermint/tendermint/rpc/client/http"
+	jsonrpcClient "github.com/tendermint/tendermint/rpc/jsonrpc/client"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrFixtureNotFound = errors.New("rpc fixture not found")
+)
+
+// rpc methods whose responses are recorded to and replayed from fixtures
+var fixtureMethods = map[string]bool{
+	"block":         true,
+	"tx":            true,
+	"status":        true,
+	"block_results": true,
+}
+
+type (
+	rpcRequest struct {
+		Id     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	rpcResponse struct {
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  json.RawMessage `json:"error,omitempty"`
+	}
+
+	// fixture is saved in file <dir>/<method>-<hash of params>.json
+	fixture struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  json.RawMessage `json:"error,omitempty"`
+	}
+
+	fixtureStore struct {
+		dir string
+	}
+
+	// recordTransport save response of every fixture method to store
+	recordTransport struct {
+		store *fixtureStore
+		next  http.RoundTripper
+	}
+
+	// replayTransport serve fixture methods from store without network
+	replayTransport struct {
+		store *fixtureStore
+	}
+)
+
+func (s *fixtureStore) path(method string, params json.RawMessage) (string, error) {
+	// params are decoded and encoded again so that order of keys doesn't matter
+	var v interface{}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &v); err != nil {
+			return "", err
+		}
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return filepath.Join(s.dir, fmt.Sprintf("%v-%v.json", method, hex.EncodeToString(sum[:8]))), nil
+}
+
+func (s *fixtureStore) save(f fixture) error {
+	path, err := s.path(f.Method, f.Params)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (s *fixtureStore) load(method string, params json.RawMessage) (*fixture, error) {
+	path, err := s.path(method, params)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w, method: %v, params: %s", ErrFixtureNotFound, method, params)
+		}
+		return nil, err
+	}
+	var f fixture
+	return &f, json.Unmarshal(data, &f)
+}
+
+// read json rpc request from body and restore body for next transport
+func readRpcRequest(req *http.Request) (*rpcRequest, error) {
+	if req.Body == nil {
+		return nil, fmt.Errorf("empty rpc request")
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var rpcReq rpcRequest
+	if err := json.Unmarshal(body, &rpcReq); err != nil {
+		// batch request isn't supported
+		return nil, err
+	}
+	return &rpcReq, nil
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rpcReq, err := readRpcRequest(req)
+	if err != nil || !fixtureMethods[rpcReq.Method] {
+		return t.next.RoundTrip(req)
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var rpcRes rpcResponse
+	if err := json.Unmarshal(body, &rpcRes); err != nil {
+		return res, nil
+	}
+	if err := t.store.save(fixture{
+		Method: rpcReq.Method,
+		Params: rpcReq.Params,
+		Result: rpcRes.Result,
+		Error:  rpcRes.Error,
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rpcReq, err := readRpcRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if !fixtureMethods[rpcReq.Method] {
+		return nil, fmt.Errorf("method %v can't be replayed", rpcReq.Method)
+	}
+	f, err := t.store.load(rpcReq.Method, rpcReq.Params)
+	if err != nil {
+		return nil, err
+	}
+	// id of response must be same as request
+	body, err := json.Marshal(struct {
+		JsonRpc string          `json:"jsonrpc"`
+		Id      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result,omitempty"`
+		Error   json.RawMessage `json:"error,omitempty"`
+	}{"2.0", rpcReq.Id, f.Result, f.Error})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// transport which sends request to node, wrapped by record or replay transport
+// according to fixture mode
+func fixtureTransport(next http.RoundTripper) http.RoundTripper {
+	store := &fixtureStore{dir: conf.SvrConf.RpcFixtureDir}
+	switch conf.SvrConf.RpcFixtureMode {
+	case conf.RpcFixtureModeRecord:
+		return &recordTransport{store: store, next: next}
+	case conf.RpcFixtureModeReplay:
+		return &replayTransport{store: store}
+	}
+	return next
+}
+
+// client which records responses of node at addr to fixtures in dir,
+// it doesn't belong to any pool
+func NewRecordClient(addr, dir string) (*Client, error) {
+	httpClient, err := jsonrpcClient.DefaultHTTPClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = &recordTransport{store: &fixtureStore{dir: dir}, next: httpClient.Transport}
+	return newFixtureClient(addr, httpClient)
+}
+
+// client which serves responses from fixtures in dir without network,
+// it doesn't belong to any pool
+func NewReplayClient(dir string) (*Client, error) {
+	addr := "http://replay"
+	httpClient, err := jsonrpcClient.DefaultHTTPClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = &replayTransport{store: &fixtureStore{dir: dir}}
+	return newFixtureClient(addr, httpClient)
+}
+
+func newFixtureClient(addr string, httpClient *http.Client) (*Client, error) {
+	client, err := rpcClient.NewWithClient(addr, "/websocket", httpClient)
+	return &Client{
+		Id:      generateId(addr),
+		Address: addr,
+		HTTP:    client,
+	}, err
+}
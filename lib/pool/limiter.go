@@ -0,0 +1,89 @@
+package pool
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiter limit requests per second and requests in flight of an endpoint,
+// callers wait until they are allowed, so busy workers are slowed down instead of failed
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // tokens per second, no limit when rate <= 0
+	burst    float64
+	tokens   float64
+	last     time.Time
+	inFlight chan struct{} // no limit when inFlight is nil
+}
+
+func newRateLimiter(rps float64, maxInFlight int) *rateLimiter {
+	l := &rateLimiter{
+		rate:  rps,
+		burst: math.Max(1, rps),
+		last:  time.Now(),
+	}
+	l.tokens = l.burst
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// wait until request is allowed, release must be called after request finished
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if delay := l.reserve(); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.cancelReserve()
+			l.release()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (l *rateLimiter) release() {
+	if l.inFlight != nil {
+		<-l.inFlight
+	}
+}
+
+// take a token, return how long caller should wait for it
+func (l *rateLimiter) reserve() time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) cancelReserve() {
+	if l.rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.burst, l.tokens+1)
+}
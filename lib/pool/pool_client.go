@@ -8,38 +8,76 @@ import (
 	"errors"
 	"fmt"
 	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/lib/retry"
+	"github.com/irisnet/rainbow-sync/utils"
 	rpcClient "github.com/tendermint/tendermint/rpc/client/http"
+	jsonrpcClient "github.com/tendermint/tendermint/rpc/jsonrpc/client"
 	"time"
 )
 
+var (
+	ErrNoEndPointForHeight = errors.New("no end point holds block of height")
+)
+
+// max time of borrowing client for height, clients rejected meanwhile are held by borrower
+const borrowForHeightTimeout = 5 * time.Second
+
 type Client struct {
-	Id string
+	Id      string
+	Address string
+	Role    string // role of pool which client belongs to
 	*rpcClient.HTTP
+
+	endPoint *endPointHealth
 }
 
-func newClient(addr string) (*Client, error) {
-	client, err := rpcClient.New(addr, "/websocket")
+func newClient(role string, endPoint *endPointHealth) (*Client, error) {
+	addr := endPoint.snapshot().Address
+	httpClient, err := jsonrpcClient.DefaultHTTPClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	// every rpc call through client is limited by rate limiter of endpoint
+	// and observed by endpoint health, waiting in limiter isn't counted as latency
+	httpClient.Transport = &limitTransport{
+		limiter: endPoint.limiter,
+		next: &healthTransport{
+			endPoint: endPoint,
+			next:     fixtureTransport(httpClient.Transport),
+		},
+	}
+	client, err := rpcClient.NewWithClient(addr, "/websocket", httpClient)
 	return &Client{
-		Id:   generateId(addr),
-		HTTP: client,
+		Id:       generateId(addr),
+		Address:  addr,
+		Role:     role,
+		HTTP:     client,
+		endPoint: endPoint,
 	}, err
 }
 
-// get client from pool
-func GetClient() *Client {
-	c, err := pool.BorrowObject(ctx)
-	for err != nil {
-		logger.Error("GetClient failed,will try again after 3 seconds", logger.String("err", err.Error()))
-		time.Sleep(3 * time.Second)
-		c, err = pool.BorrowObject(ctx)
-	}
+// get client from pool of role, borrowing is retried with backoff until it succeeds
+func GetClient(role string) *Client {
+	pool := getPool(role)
+	var c interface{}
+	retry.Do(ctx, "pool.GetClient", retry.Default().Forever(), func(int) error {
+		var err error
+		if c, err = pool.BorrowObject(ctx); err != nil {
+			return utils.WrapErr(utils.ErrKindRpc, "pool.GetClient", fmt.Errorf("role %v: %w", role, err))
+		}
+		return nil
+	})
 
 	return c.(*Client)
 }
 
 // release client
 func (c *Client) Release() {
-	err := pool.ReturnObject(ctx, c)
+	if c.endPoint == nil {
+		// client isn't borrowed from pool
+		return
+	}
+	err := getPool(c.Role).ReturnObject(ctx, c)
 	if err != nil {
 		logger.Error(err.Error())
 	}
@@ -51,11 +89,72 @@ func (c *Client) HeartBeat() error {
 	return err
 }
 
+// get client of role whose endpoint holds block of height, unavailable error is returned
+// if all endpoints of role have pruned it or no client is got in borrowForHeightTimeout
+func GetClientForHeight(role string, height int64) (*Client, error) {
+	pool := getPool(role)
+	if !factories[role].canServe(height) {
+		return nil, utils.WrapErr(utils.ErrKindUnavailable, "pool.GetClientForHeight", ErrNoEndPointForHeight).
+			WithHeight(height)
+	}
+
+	var rejected []*Client
+	defer func() {
+		for _, v := range rejected {
+			v.Release()
+		}
+	}()
+	// idle clients are borrowed first, at most all of them are rejected
+	// before pool makes a new client on endpoint which holds the height
+	borrowCtx, cancel := context.WithTimeout(context.WithValue(ctx, heightKey{}, height), borrowForHeightTimeout)
+	defer cancel()
+	for i := pool.GetNumIdle(); i >= 0; i-- {
+		c, err := pool.BorrowObject(borrowCtx)
+		if err != nil {
+			kind := utils.ErrKindRpc
+			if errors.Is(err, ErrNoEndPointForHeight) || borrowCtx.Err() != nil {
+				// pool is exhausted or endpoints holding the height are gone, fail fast
+				kind = utils.ErrKindUnavailable
+			}
+			return nil, utils.WrapErr(kind, "pool.GetClientForHeight", err).WithHeight(height)
+		}
+		client := c.(*Client)
+		if client.CanServe(height) {
+			return client, nil
+		}
+		// client on pruned endpoint, hold it so that next borrow gets another one
+		rejected = append(rejected, client)
+	}
+
+	return nil, utils.WrapErr(utils.ErrKindUnavailable, "pool.GetClientForHeight",
+		fmt.Errorf("can't borrow client holding height from pool")).WithHeight(height)
+}
+
+// whether endpoint of client holds block of height
+func (c *Client) CanServe(height int64) bool {
+	if c.endPoint == nil {
+		return true
+	}
+	return c.endPoint.snapshot().CanServe(height)
+}
+
+// whether any available endpoint of factory holds block of height
+func (f *PoolFactory) canServe(height int64) bool {
+	var found bool
+	f.peersMap.Range(func(k, value interface{}) bool {
+		endPoint := value.(*endPointHealth).snapshot()
+		found = endPoint.Available && endPoint.CanServe(height)
+		return !found
+	})
+	return found
+}
+
 func generateId(address string) string {
 	return fmt.Sprintf("peer[%s]", address)
 }
 
-func GetClientWithTimeout(timeout time.Duration) (*Client, error) {
+func GetClientWithTimeout(role string, timeout time.Duration) (*Client, error) {
+	pool := getPool(role)
 	c := make(chan interface{})
 	errCh := make(chan error)
 	go func() {
@@ -72,6 +171,6 @@ func GetClientWithTimeout(timeout time.Duration) (*Client, error) {
 	case res := <-errCh:
 		return nil, res
 	case <-time.After(timeout):
-		return nil, errors.New("rpc node timeout")
+		return nil, utils.WrapErr(utils.ErrKindRpc, "pool.GetClientWithTimeout", errors.New("rpc node timeout"))
 	}
-}
\ No newline at end of file
+}
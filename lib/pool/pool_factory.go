@@ -5,63 +5,95 @@ import (
 	"github.com/irisnet/rainbow-sync/conf"
 	"github.com/irisnet/rainbow-sync/lib/logger"
 	commonPool "github.com/jolestar/go-commons-pool"
-	"math/rand"
+	"sort"
 	"sync"
 )
 
 type (
 	PoolFactory struct {
+		role     string
 		peersMap sync.Map
 	}
-	EndPoint struct {
-		Address   string
-		Available bool
-	}
+
+	// context key of height which client is borrowed for
+	heightKey struct{}
 )
 
 var (
-	poolFactory PoolFactory
-	pool        *commonPool.ObjectPool
-	ctx         = context.Background()
+	// endpoints shared by pools of all roles, so that a node in several pools
+	// has one health state and one rate limiter
+	endPoints sync.Map
+	pools     = make(map[string]*commonPool.ObjectPool)
+	factories = make(map[string]*PoolFactory)
+	ctx       = context.Background()
 )
 
-func init() {
-	var syncMap sync.Map
-	for _, url := range conf.SvrConf.NodeUrls {
-		key := generateId(url)
-		endPoint := EndPoint{
-			Address:   url,
-			Available: true,
+// start client pool of every node role
+func Start() {
+	for _, role := range []string{conf.NodeRoleArchive, conf.NodeRoleTip} {
+		poolConf := conf.SvrConf.NodePools[role]
+		factory := &PoolFactory{role: role}
+		for _, url := range poolConf.NodeUrls {
+			key := generateId(url)
+			endPoint, _ := endPoints.LoadOrStore(key, newEndPointHealth(url))
+			factory.peersMap.Store(key, endPoint)
 		}
 
-		syncMap.Store(key, endPoint)
+		config := commonPool.NewDefaultPoolConfig()
+		config.MaxTotal = poolConf.MaxConnectionNum
+		config.MaxIdle = poolConf.InitConnectionNum
+		config.MinIdle = poolConf.InitConnectionNum
+		config.TestOnBorrow = true
+		config.TestOnCreate = true
+		config.TestWhileIdle = true
+
+		logger.Info("PoolConfig", logger.String("role", role),
+			logger.Any("nodeUrls", poolConf.NodeUrls),
+			logger.Int("config.MaxTotal", config.MaxTotal),
+			logger.Int("config.MaxIdle", config.MaxIdle))
+		factories[role] = factory
+		pools[role] = commonPool.NewObjectPool(ctx, factory, config)
+		pools[role].PreparePool(ctx)
 	}
-	poolFactory = PoolFactory{
-		peersMap: syncMap,
+}
+
+func ClosePool() {
+	for _, v := range pools {
+		v.Close(ctx)
 	}
+}
 
-	config := commonPool.NewDefaultPoolConfig()
-	config.MaxTotal = conf.SvrConf.MaxConnectionNum
-	config.MaxIdle = conf.SvrConf.InitConnectionNum
-	config.MinIdle = conf.SvrConf.InitConnectionNum
-	config.TestOnBorrow = true
-	config.TestOnCreate = true
-	config.TestWhileIdle = true
-
-	logger.Info("PoolConfig", logger.Int("config.MaxTotal", config.MaxTotal),
-		logger.Int("config.MaxIdle", config.MaxIdle))
-	pool = commonPool.NewObjectPool(ctx, &poolFactory, config)
-	pool.PreparePool(ctx)
+// get pool of role, it panics if role is unknown
+func getPool(role string) *commonPool.ObjectPool {
+	p, ok := pools[role]
+	if !ok {
+		logger.Panic("unknown node role or pool isn't started", logger.String("role", role))
+	}
+	return p
 }
 
-func ClosePool() {
-	pool.Close(ctx)
+// get health snapshot of all endpoints, sorted by address
+func EndPoints() []EndPoint {
+	var snapshots []EndPoint
+	endPoints.Range(func(k, value interface{}) bool {
+		snapshots = append(snapshots, value.(*endPointHealth).snapshot())
+		return true
+	})
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Address < snapshots[j].Address
+	})
+	return snapshots
 }
 
 func (f *PoolFactory) MakeObject(ctx context.Context) (*commonPool.PooledObject, error) {
-	endpoint := f.GetEndPoint()
-	c, err := newClient(endpoint.Address)
+	height, _ := ctx.Value(heightKey{}).(int64)
+	endpoint := f.GetEndPoint(height)
+	if endpoint == nil {
+		return nil, ErrNoEndPointForHeight
+	}
+	c, err := newClient(f.role, endpoint)
 	if err != nil {
+		endpoint.recordFailure()
 		return nil, err
 	} else {
 		return commonPool.NewPooledObject(c), nil
@@ -79,20 +111,22 @@ func (f *PoolFactory) DestroyObject(ctx context.Context, object *commonPool.Pool
 func (f *PoolFactory) ValidateObject(ctx context.Context, object *commonPool.PooledObject) bool {
 	// do validate
 	c := object.Object.(*Client)
+	// client on an open endpoint will be destroyed,
+	// then pool make new client on other endpoint
+	if c.endPoint.snapshot().State == EndPointStateOpen {
+		return false
+	}
+	// result of heartbeat and status is recorded by transport of client
 	if c.HeartBeat() != nil {
-		value, ok := f.peersMap.Load(c.Id)
-		if ok {
-			endPoint := value.(EndPoint)
-			endPoint.Available = true
-			f.peersMap.Store(c.Id, endPoint)
-		}
 		return false
 	}
 	stat, err := c.Status(ctx)
 	if err != nil {
 		return false
 	}
+	c.endPoint.recordHeights(stat.SyncInfo.EarliestBlockHeight, stat.SyncInfo.LatestBlockHeight)
 	if stat.SyncInfo.CatchingUp {
+		c.endPoint.recordFailure()
 		return false
 	}
 	return true
@@ -106,32 +140,53 @@ func (f *PoolFactory) PassivateObject(ctx context.Context, object *commonPool.Po
 	return nil
 }
 
-func (f *PoolFactory) GetEndPoint() EndPoint {
+// select endpoint weighted by observed latency and height freshness,
+// endpoints whose circuit is open are skipped until they can be probed,
+// endpoints which don't hold block of height are skipped if height > 0,
+// nil is returned if no endpoint holds block of height
+func (f *PoolFactory) GetEndPoint(height int64) *endPointHealth {
 	var (
-		keys        []string
-		selectedKey string
+		candidates []*endPointHealth
+		snapshots  []EndPoint
+		fallback   *endPointHealth
+		found      bool
 	)
 
 	f.peersMap.Range(func(k, value interface{}) bool {
-		key := k.(string)
-		endPoint := value.(EndPoint)
-		if endPoint.Available {
-			keys = append(keys, key)
+		found = true
+		endPoint := value.(*endPointHealth)
+		if !endPoint.snapshot().CanServe(height) {
+			// client on it would be rejected by borrower of height
+			return true
+		}
+		if endPoint.selectable() {
+			candidates = append(candidates, endPoint)
+			snapshots = append(snapshots, endPoint.snapshot())
+		}
+		if fallback == nil || endPoint.openedTime().Before(fallback.openedTime()) {
+			fallback = endPoint
 		}
-		selectedKey = key
 
 		return true
 	})
 
-	if len(keys) > 0 {
-		index := rand.Intn(len(keys))
-		selectedKey = keys[index]
+	for len(candidates) > 0 {
+		index := selectWeighted(snapshots)
+		if candidates[index].acquire() {
+			return candidates[index]
+		}
+		candidates = append(candidates[:index], candidates[index+1:]...)
+		snapshots = append(snapshots[:index], snapshots[index+1:]...)
 	}
-	value, ok := f.peersMap.Load(selectedKey)
-	if ok {
-		return value.(EndPoint)
-	} else {
-		logger.Error("Can't get selected end point", logger.String("selectedKey", selectedKey))
+
+	if !found {
+		logger.Fatal("Can't get end point, node urls are empty")
+	}
+	if fallback == nil {
+		return nil
 	}
-	return EndPoint{}
+	// all endpoints are unavailable, use the one which has been open longest
+	logger.Error("Can't get available end point, use fallback end point",
+		logger.String("address", fallback.snapshot().Address))
+	return fallback
 }
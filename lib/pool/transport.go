@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthTransport record latency and failure of every request to endpoint
+type healthTransport struct {
+	endPoint *endPointHealth
+	next     http.RoundTripper
+}
+
+func (t *healthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	begin := time.Now()
+	res, err := t.next.RoundTrip(req)
+	if req.Context().Err() != nil {
+		// request is canceled by caller, it says nothing about endpoint
+		return res, err
+	}
+	if err != nil || res.StatusCode >= http.StatusInternalServerError {
+		t.endPoint.recordFailure()
+	} else {
+		t.endPoint.recordSuccess(time.Since(begin))
+	}
+	return res, err
+}
+
+// limitTransport wait for rate limiter of endpoint before every request
+type limitTransport struct {
+	limiter *rateLimiter
+	next    http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.limiter.release()
+		return res, err
+	}
+	// request is in flight until response body is closed
+	res.Body = &releaseOnClose{ReadCloser: res.Body, release: t.limiter.release}
+	return res, nil
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
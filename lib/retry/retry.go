@@ -0,0 +1,142 @@
+package retry
+
+import (
+	"context"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/monitor/metrics"
+	"github.com/irisnet/rainbow-sync/utils"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Policy decides whether and when operation failed with error is retried.
+// errors which aren't retryable, such as unavailable height, are never retried
+type Policy struct {
+	MaxAttempts    int // attempts including first one, unlimited when 0
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64 // fraction of backoff which is randomized, 0.2 means ±20%
+	// max attempts of retryable error kind, it overrides MaxAttempts
+	KindMaxAttempts map[utils.ErrKind]int
+}
+
+var (
+	defaultPolicy = newPolicy(conf.SvrConf)
+
+	retries, _ = metrics.CovertCounter(metrics.NewCounter(
+		"sync",
+		"retry",
+		"retries",
+		"num of retries of failed operation",
+		[]string{"op", "kind"},
+	))
+	giveUps, _ = metrics.CovertCounter(metrics.NewCounter(
+		"sync",
+		"retry",
+		"give_ups",
+		"num of failed operations which aren't retried any more",
+		[]string{"op", "kind"},
+	))
+)
+
+func newPolicy(c *conf.ServerConf) Policy {
+	kinds := make(map[utils.ErrKind]int, len(c.RetryKindMaxAttempts))
+	for k, v := range c.RetryKindMaxAttempts {
+		kinds[utils.ErrKind(k)] = v
+	}
+	return Policy{
+		MaxAttempts:     c.RetryMaxAttempts,
+		InitialBackoff:  time.Duration(c.RetryInitialBackoffMs) * time.Millisecond,
+		MaxBackoff:      time.Duration(c.RetryMaxBackoffMs) * time.Millisecond,
+		Multiplier:      c.RetryBackoffMultiplier,
+		Jitter:          c.RetryJitter,
+		KindMaxAttempts: kinds,
+	}
+}
+
+// policy of env RETRY_*, it's shared by rpc and db calls
+func Default() Policy {
+	return defaultPolicy
+}
+
+// copy of policy which retries retryable errors until success, such as borrowing client from pool
+func (p Policy) Forever() Policy {
+	p.MaxAttempts = 0
+	p.KindMaxAttempts = nil
+	return p
+}
+
+// whether operation failed with err at attempt(start from 1) should be retried
+func (p Policy) ShouldRetry(err error, attempt int) bool {
+	if !utils.IsRetryable(err) {
+		return false
+	}
+	max := p.MaxAttempts
+	if n, ok := p.KindMaxAttempts[utils.ErrKindOf(err)]; ok {
+		max = n
+	}
+	return max == 0 || attempt < max
+}
+
+// backoff after attempt(start from 1) fails, it grows exponentially up to MaxBackoff with jitter
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if max := float64(p.MaxBackoff); p.MaxBackoff > 0 && backoff > max {
+		backoff = max
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// wait backoff after attempt of op fails with err, the retry is logged and counted.
+// ctx error is returned if ctx is done before backoff elapses
+func (p Policy) Wait(ctx context.Context, op string, attempt int, err error) error {
+	backoff := p.Backoff(attempt)
+	retries.With("op", op, "kind", string(utils.ErrKindOf(err))).Add(1)
+	fields := append([]logger.Field{
+		logger.String("op", op),
+		logger.Int("attempt", attempt),
+		logger.Duration("backoff", backoff),
+	}, utils.ErrFields(err)...)
+	logger.FromContext(ctx).Warn("operation fail, retry after backoff", fields...)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// run fn until it succeeds, fails with error which shouldn't be retried or ctx is done,
+// attempt passed to fn starts from 1, error of last attempt is returned
+func Do(ctx context.Context, op string, p Policy, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+		if !p.ShouldRetry(err, attempt) {
+			giveUps.With("op", op, "kind", string(utils.ErrKindOf(err))).Add(1)
+			if attempt > 1 {
+				logger.FromContext(ctx).Warn("operation fail, give up retry",
+					append([]logger.Field{logger.String("op", op), logger.Int("attempts", attempt)},
+						utils.ErrFields(err)...)...)
+			}
+			return err
+		}
+		if p.Wait(ctx, op, attempt, err) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"github.com/irisnet/rainbow-sync/utils"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("backoff of attempt %v is %v, want %v", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 160*time.Millisecond || got > 240*time.Millisecond {
+			t.Fatalf("backoff %v is out of jitter range", got)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	p := Policy{MaxAttempts: 3, KindMaxAttempts: map[utils.ErrKind]int{utils.ErrKindDb: 5}}
+	rpcErr := utils.WrapErr(utils.ErrKindRpc, "rpc.Block", errors.New("timeout"))
+	dbErr := utils.WrapErr(utils.ErrKindDb, "db.Txn", errors.New("no reachable servers"))
+	unavailableErr := utils.WrapErr(utils.ErrKindUnavailable, "dump.Load", errors.New("not found"))
+
+	if !p.ShouldRetry(rpcErr, 2) || p.ShouldRetry(rpcErr, 3) {
+		t.Error("rpc err should be retried until 3 attempts")
+	}
+	if !p.ShouldRetry(dbErr, 4) || p.ShouldRetry(dbErr, 5) {
+		t.Error("db err should be retried until 5 attempts of kind")
+	}
+	if p.ShouldRetry(unavailableErr, 1) {
+		t.Error("unavailable err shouldn't be retried")
+	}
+	if !p.Forever().ShouldRetry(dbErr, 100) {
+		t.Error("err should be retried forever")
+	}
+}
+
+func TestDo(t *testing.T) {
+	p := Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	rpcErr := utils.WrapErr(utils.ErrKindRpc, "rpc.Block", errors.New("timeout"))
+
+	var attempts int
+	err := Do(context.Background(), "test", p, func(attempt int) error {
+		attempts = attempt
+		if attempt < 2 {
+			return rpcErr
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("should succeed at attempt 2, err: %v, attempts: %v", err, attempts)
+	}
+
+	err = Do(context.Background(), "test", p, func(attempt int) error {
+		attempts = attempt
+		return rpcErr
+	})
+	if err != rpcErr || attempts != 3 {
+		t.Fatalf("should give up after 3 attempts, err: %v, attempts: %v", err, attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Do(ctx, "test", p.Forever(), func(attempt int) error {
+		attempts = attempt
+		return rpcErr
+	})
+	if err != rpcErr || attempts != 1 {
+		t.Fatalf("should stop when ctx is done, err: %v, attempts: %v", err, attempts)
+	}
+}
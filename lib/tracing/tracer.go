@@ -0,0 +1,138 @@
+//tracer of OpenTelemetry which export spans with OTLP over http,
+//spans aren't recorded unless TRACE_EXPORTER is set.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"net/url"
+	"time"
+)
+
+const (
+	ExporterNone = "none"
+	ExporterOtlp = "otlp"
+
+	SamplerAlwaysOn     = "always_on"
+	SamplerAlwaysOff    = "always_off"
+	SamplerTraceIdRatio = "traceidratio"
+
+	instrumentationName = "github.com/irisnet/rainbow-sync"
+	shutdownTimeout     = 10 * time.Second
+)
+
+// span of OpenTelemetry, status of span is set to error when error is recorded
+type Span struct {
+	trace.Span
+}
+
+// provider is nil when tracing is disabled, spans of global no-op provider are dropped
+var provider *sdktrace.TracerProvider
+
+func init() {
+	enabled, err := configure(conf.SvrConf)
+	if err != nil {
+		logger.Fatal("init tracer fail", logger.String("err", err.Error()))
+	}
+	if !enabled {
+		return
+	}
+	logger.Info("TraceConfig", logger.String("exporter", conf.SvrConf.TraceExporter),
+		logger.String("endpoint", conf.SvrConf.TraceOtlpEndpoint),
+		logger.String("sampler", conf.SvrConf.TraceSampler))
+}
+
+// set global tracer provider by config, sampler is validated only when tracing is enabled
+// so that settings of sampler left by disabled tracing don't stop the process
+func configure(c *conf.ServerConf) (bool, error) {
+	switch c.TraceExporter {
+	case ExporterNone, "":
+		return false, nil
+	case ExporterOtlp:
+		sampler, err := newSampler(c.TraceSampler, c.TraceSamplerRatio)
+		if err != nil {
+			return false, err
+		}
+		opts, err := otlpOptions(c.TraceOtlpEndpoint)
+		if err != nil {
+			return false, err
+		}
+		// exporter connects to collector lazily, spans are dropped while collector is down
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return false, err
+		}
+		provider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithSampler(sampler),
+			sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", c.TraceServiceName))),
+		)
+		otel.SetTracerProvider(provider)
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown trace exporter %v", c.TraceExporter)
+}
+
+// sampler of root spans, child spans follow the decision of parent span
+func newSampler(name string, ratio float64) (sdktrace.Sampler, error) {
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case SamplerTraceIdRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %v", name)
+}
+
+// endpoint is url of otlp http receiver like http://localhost:4318
+func otlpOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %v", endpoint)
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return opts, nil
+}
+
+// flush buffered spans and stop exporter
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		logger.Warn("shutdown tracer fail", logger.String("err", err.Error()))
+	}
+}
+
+// start a span as child of the span in ctx,
+// return a new context which carry the started span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, Span{span}
+}
+
+// record err and mark span status as error, nil err is ignored
+func (s Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.Span.RecordError(err)
+	s.Span.SetStatus(codes.Error, err.Error())
+}
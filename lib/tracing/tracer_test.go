@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/irisnet/rainbow-sync/conf"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// set global provider recording spans in memory, provider is reset by returned func
+func recordSpans(sampler sdktrace.Sampler) (*tracetest.InMemoryExporter, func()) {
+	exporter := tracetest.NewInMemoryExporter()
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(sampler)))
+	return exporter, func() { otel.SetTracerProvider(old) }
+}
+
+func TestStart_ChildFollowParent(t *testing.T) {
+	sampler, _ := newSampler(SamplerAlwaysOn, 1)
+	exporter, reset := recordSpans(sampler)
+	defer reset()
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child", attribute.Int64("height", 1))
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("both spans should be exported, got %v", len(spans))
+	}
+	if spans[0].SpanContext.TraceID() != spans[1].SpanContext.TraceID() {
+		t.Fatal("child span should have the trace id of parent")
+	}
+	if spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Fatal("child span should refer to parent span")
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	sampler, err := newSampler(SamplerAlwaysOff, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter, reset := recordSpans(sampler)
+	defer reset()
+
+	// child follows sampled remote parent though root spans are never sampled
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	_, child := Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "child")
+	child.End()
+	_, root := Start(context.Background(), "root")
+	root.End()
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Name != "child" {
+		t.Fatalf("only child of sampled parent should be sampled, got %v spans", len(spans))
+	}
+
+	if _, err := newSampler("unknown", 1); err == nil {
+		t.Error("unknown sampler should fail")
+	}
+}
+
+func TestSpan_RecordError(t *testing.T) {
+	sampler, _ := newSampler(SamplerAlwaysOn, 1)
+	exporter, reset := recordSpans(sampler)
+	defer reset()
+
+	_, span := Start(context.Background(), "block.ParseBlock")
+	span.RecordError(nil)
+	span.RecordError(errors.New("decode fail"))
+	span.End()
+	if got := exporter.GetSpans()[0]; got.Status.Code != codes.Error || len(got.Events) != 1 {
+		t.Fatalf("span should be marked as error once, got %+v", got.Status)
+	}
+}
+
+func TestOtlpExporter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %v", r.URL.Path)
+		}
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	old := otel.GetTracerProvider()
+	defer func() { otel.SetTracerProvider(old); provider = nil }()
+	c := conf.ServerConf{TraceExporter: ExporterOtlp, TraceSampler: SamplerAlwaysOn,
+		TraceOtlpEndpoint: server.URL, TraceServiceName: "rainbow-sync"}
+	if enabled, err := configure(&c); !enabled || err != nil {
+		t.Fatalf("tracing should be enabled, got %v", err)
+	}
+
+	_, span := Start(context.Background(), "block.ParseBlock", attribute.Int64("height", 3742170))
+	span.End()
+	Shutdown()
+
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("spans should be flushed to collector on shutdown, got %v requests", requests)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	// invalid sampler is ignored when tracing is disabled
+	c := conf.ServerConf{TraceExporter: ExporterNone, TraceSampler: "unknown"}
+	if enabled, err := configure(&c); enabled || err != nil {
+		t.Errorf("disabled tracing shouldn't validate sampler, got %v", err)
+	}
+	c.TraceExporter = ExporterOtlp
+	if _, err := configure(&c); err == nil {
+		t.Error("invalid sampler should fail when tracing is enabled")
+	}
+	c.TraceSampler, c.TraceOtlpEndpoint = SamplerAlwaysOn, "localhost"
+	if _, err := configure(&c); err == nil {
+		t.Error("endpoint without scheme should fail")
+	}
+	c.TraceExporter = "jaeger"
+	if _, err := configure(&c); err == nil {
+		t.Error("unknown exporter should fail")
+	}
+}
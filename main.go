@@ -1,27 +1,43 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/admin"
+	"github.com/irisnet/rainbow-sync/api"
+	"github.com/irisnet/rainbow-sync/conf"
 	"github.com/irisnet/rainbow-sync/db"
 	"github.com/irisnet/rainbow-sync/lib/logger"
 	"github.com/irisnet/rainbow-sync/lib/pool"
+	"github.com/irisnet/rainbow-sync/lib/tracing"
+	"github.com/irisnet/rainbow-sync/migration"
 	"github.com/irisnet/rainbow-sync/model"
 	"github.com/irisnet/rainbow-sync/task"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"runtime"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if !runCommand(os.Args[1], os.Args[2:]) {
+			fmt.Fprintf(os.Stderr, "unknown command %v\n", os.Args[1])
+			os.Exit(2)
+		}
+		return
+	}
 	runtime.GOMAXPROCS(runtime.NumCPU() / 2)
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 
 	defer func() {
 		logger.Info("System Exit")
 
 		db.Stop()
 		pool.ClosePool()
+		tracing.Shutdown()
 
 		if err := recover(); err != nil {
 			logger.Error("", logger.Any("err", err))
@@ -29,13 +45,29 @@ func main() {
 		}
 	}()
 
-	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(c, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	logger.Info("Start sync Program")
 
 	db.Start()
+	if conf.SvrConf.SyncSource == conf.SyncSourceRpc {
+		pool.Start()
+	}
+	migration.Start()
 	model.EnsureDocsIndexes()
-	task.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := task.Start(ctx)
+	go api.Start()
+	go admin.Start()
+	go logger.StartLevelServer()
 
-	<-c
+	sig := <-c
+	logger.Info("Stop sync Program", logger.String("signal", sig.String()))
+	// workers finish current height and release their tasks before db is stopped
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Duration(conf.SvrConf.ShutdownTimeout) * time.Second):
+		logger.Warn("shutdown timeout, tasks which aren't released are taken over after they expire")
+	}
 }
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Context of running migration, progress is saved as checkpoint
+// so that migration is resumed from it after restart
+type Context struct {
+	version    int
+	checkpoint interface{}
+}
+
+// checkpoint saved by last run of migration, nil if it's first run
+func (ctx *Context) Checkpoint() interface{} {
+	return ctx.checkpoint
+}
+
+// save checkpoint, it also renews lease of migration
+func (ctx *Context) SaveCheckpoint(v interface{}) error {
+	if err := updateRecord(ctx.version, bson.M{"checkpoint": v}); err != nil {
+		return err
+	}
+	ctx.checkpoint = v
+	return nil
+}
+
+// iterate documents of collection matching query in batches ordered by _id,
+// _id of last document in batch is saved as checkpoint after fn succeeds
+func (ctx *Context) EachBatch(collectionName string, query bson.M, batchSize int, fn func(docs []bson.M) error) error {
+	for {
+		q := bson.M{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if ctx.checkpoint != nil {
+			q["_id"] = bson.M{"$gt": ctx.checkpoint}
+		}
+
+		var docs []bson.M
+		err := db.ExecCollection(collectionName, func(c *mgo.Collection) error {
+			return c.Find(q).Sort("_id").Limit(batchSize).All(&docs)
+		})
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+		if err := fn(docs); err != nil {
+			return err
+		}
+		if err := ctx.SaveCheckpoint(docs[len(docs)-1]["_id"]); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// versioned schema migrations of db, applied migrations are recorded in schema_migrations
+
+package migration
+
+import (
+	"fmt"
+	"github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	CollectionNameSchemaMigration = "schema_migrations"
+
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+
+	// migration running by other instance is taken over if it isn't updated within lease
+	migrationLease = 2 * time.Minute
+)
+
+type (
+	// Migration change shape of documents, it's applied once in order of version.
+	// background migration runs after foreground ones without blocking sync,
+	// so foreground migration mustn't depend on it
+	Migration struct {
+		Version    int
+		Name       string
+		Background bool
+		Up         func(ctx *Context) error
+	}
+
+	// record of migration in schema_migrations
+	record struct {
+		Version    int         `bson:"_id"`
+		Name       string      `bson:"name"`
+		Status     string      `bson:"status"`
+		Owner      string      `bson:"owner"`
+		Checkpoint interface{} `bson:"checkpoint"`
+		Error      string      `bson:"error"`
+		StartTime  int64       `bson:"start_time"`
+		UpdateTime int64       `bson:"update_time"`
+		FinishTime int64       `bson:"finish_time"`
+	}
+)
+
+var (
+	migrations []Migration
+	owner      = genOwner()
+)
+
+func genOwner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%v@%v", hostname, bson.NewObjectId().Hex())
+}
+
+func register(m Migration) {
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// latest schema version known by this binary
+func LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// check schema version of db and apply pending migrations,
+// foreground migrations are applied before it returns
+func Start() {
+	records, err := loadRecords()
+	if err != nil {
+		logger.Fatal("load schema migrations fail", logger.String("err", err.Error()))
+	}
+	if err := checkVersion(records, LatestVersion()); err != nil {
+		logger.Fatal("check schema version fail", logger.String("err", err.Error()))
+	}
+
+	var background []Migration
+	for _, m := range pending(records) {
+		if m.Background {
+			background = append(background, m)
+			continue
+		}
+		if err := run(m); err != nil {
+			logger.Fatal("apply migration fail", logger.Int("version", m.Version),
+				logger.String("name", m.Name), logger.String("err", err.Error()))
+		}
+	}
+	if len(background) > 0 {
+		go func() {
+			for _, m := range background {
+				if err := run(m); err != nil {
+					// later migrations may depend on it, retry on next startup
+					logger.Error("apply background migration fail", logger.Int("version", m.Version),
+						logger.String("name", m.Name), logger.String("err", err.Error()))
+					return
+				}
+			}
+		}()
+	}
+}
+
+// refuse db migrated by newer version of syncer, documents may have shape unknown to this binary
+func checkVersion(records map[int]record, latest int) error {
+	for version, r := range records {
+		if version > latest {
+			return fmt.Errorf("schema version %v(%v) of db is newer than %v supported by this binary",
+				version, r.Name, latest)
+		}
+	}
+	return nil
+}
+
+func pending(records map[int]record) []Migration {
+	var ret []Migration
+	for _, m := range migrations {
+		if r, ok := records[m.Version]; !ok || r.Status != StatusCompleted {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// claim migration and apply it, migration claimed by other instance is waited for
+func run(m Migration) error {
+	for {
+		r, claimed, err := claim(m)
+		if err != nil {
+			return err
+		}
+		if r.Status == StatusCompleted {
+			return nil
+		}
+		if claimed {
+			logger.Info("start apply migration", logger.Int("version", m.Version), logger.String("name", m.Name),
+				logger.Bool("resume", r.Checkpoint != nil))
+			begin := time.Now()
+			ctx := &Context{version: m.Version, checkpoint: r.Checkpoint}
+			if err := m.Up(ctx); err != nil {
+				updateRecord(m.Version, bson.M{"status": StatusFailed, "error": err.Error()})
+				return err
+			}
+			logger.Info("finish apply migration", logger.Int("version", m.Version), logger.String("name", m.Name),
+				logger.String("cost", time.Since(begin).String()))
+			return updateRecord(m.Version, bson.M{"status": StatusCompleted, "error": "",
+				"finish_time": time.Now().Unix()})
+		}
+		logger.Info("migration is applied by other instance, wait for it", logger.Int("version", m.Version),
+			logger.String("owner", r.Owner))
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// claim migration if it isn't running by other instance or its lease expired
+func claim(m Migration) (record, bool, error) {
+	var r record
+	now := time.Now().Unix()
+	err := db.ExecCollection(CollectionNameSchemaMigration, func(c *mgo.Collection) error {
+		err := c.Insert(record{Version: m.Version, Name: m.Name, Status: StatusRunning, Owner: owner,
+			StartTime: now, UpdateTime: now})
+		if err == nil {
+			return c.FindId(m.Version).One(&r)
+		}
+		if !mgo.IsDup(err) {
+			return err
+		}
+		_, err = c.Find(bson.M{
+			"_id":    m.Version,
+			"status": bson.M{"$ne": StatusCompleted},
+			"$or": []bson.M{
+				{"status": StatusFailed},
+				{"owner": owner},
+				{"update_time": bson.M{"$lt": now - int64(migrationLease.Seconds())}},
+			},
+		}).Apply(mgo.Change{
+			Update: bson.M{"$set": bson.M{"status": StatusRunning, "owner": owner, "update_time": now}},
+		}, nil)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		return c.FindId(m.Version).One(&r)
+	})
+	return r, err == nil && r.Status == StatusRunning && r.Owner == owner, err
+}
+
+func updateRecord(version int, set bson.M) error {
+	set["update_time"] = time.Now().Unix()
+	return db.ExecCollection(CollectionNameSchemaMigration, func(c *mgo.Collection) error {
+		return c.Update(bson.M{"_id": version, "owner": owner}, bson.M{"$set": set})
+	})
+}
+
+func loadRecords() (map[int]record, error) {
+	var records []record
+	err := db.ExecCollection(CollectionNameSchemaMigration, func(c *mgo.Collection) error {
+		return c.Find(nil).All(&records)
+	})
+	ret := make(map[int]record, len(records))
+	for _, v := range records {
+		ret[v.Version] = v
+	}
+	return ret, err
+}
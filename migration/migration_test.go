@@ -0,0 +1,43 @@
+package migration
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Fatalf("version of migration %v isn't greater than %v", migrations[i].Name, migrations[i-1].Name)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	latest := LatestVersion()
+	records := map[int]record{
+		1: {Version: 1, Status: StatusCompleted},
+	}
+	if err := checkVersion(records, latest); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending(records)) != len(migrations)-1 {
+		t.Fatalf("unexpected pending migrations %v", pending(records))
+	}
+
+	records[latest+1] = record{Version: latest + 1, Name: "newer", Status: StatusCompleted}
+	if err := checkVersion(records, latest); err == nil {
+		t.Fatal("db of newer version should be refused")
+	}
+}
+
+func TestTimeoutPacketDenom(t *testing.T) {
+	doc := bson.M{"msg": bson.M{"type": "timeout_packet", "msg": bson.M{"packet": bson.M{
+		"data": bson.M{"denom": "transfer/channel-1/uatom"}}}}}
+	if denom := timeoutPacketDenom(doc); denom != "transfer/channel-1/uatom" {
+		t.Errorf("unexpected denom %q", denom)
+	}
+	if denom := timeoutPacketDenom(bson.M{"msg": bson.M{}}); denom != "" {
+		t.Errorf("missing denom should be empty, got %q", denom)
+	}
+}
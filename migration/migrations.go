@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/model"
+	. "github.com/kaifei-bianjie/msg-parser/modules"
+	msgutils "github.com/kaifei-bianjie/msg-parser/utils"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// migrations are registered in init, version of new migration must be greater than existing ones
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(ctx *Context) error {
+			// schema before migrations are introduced
+			return nil
+		},
+	})
+	register(Migration{
+		Version:    2,
+		Name:       "backfill_tx_msg_tx_addrs",
+		Background: true,
+		Up:         backfillTxMsgTxAddrs,
+	})
+	register(Migration{
+		Version:    3,
+		Name:       "timeout_msg_sent_denoms",
+		Background: true,
+		Up:         rewriteTimeoutMsgDenoms,
+	})
+}
+
+// token of timeout packet is refunded to sender, its denom is denom on this chain like timeout on close.
+// timeout msgs synced by old version have denom on counterparty chain, they are rewritten
+func rewriteTimeoutMsgDenoms(ctx *Context) error {
+	// packet denom without trace path is native token, its denom is unchanged
+	query := bson.M{"type": MsgTypeTimeout, "msg.msg.packet.data.denom": bson.RegEx{Pattern: "/"}}
+	return ctx.EachBatch(model.CollectionNameIrisTxMsg, query, 500, func(docs []bson.M) error {
+		return db.ExecCollection(model.CollectionNameIrisTxMsg, func(c *mgo.Collection) error {
+			for _, v := range docs {
+				denom := timeoutPacketDenom(v)
+				if denom == "" {
+					continue
+				}
+				err := c.UpdateId(v["_id"], bson.M{"$set": bson.M{"denoms": []string{msgutils.IBCDenom(denom)}}})
+				if err != nil && err != mgo.ErrNotFound {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// denom in packet of timeout msg doc, empty if it's missing
+func timeoutPacketDenom(doc bson.M) string {
+	v := interface{}(doc)
+	for _, key := range []string{"msg", "msg", "packet", "data", "denom"} {
+		m, ok := v.(bson.M)
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+	denom, _ := v.(string)
+	return denom
+}
+
+// tx_addrs and tx_signers of tx msgs synced by old version are copied from their txs
+func backfillTxMsgTxAddrs(ctx *Context) error {
+	query := bson.M{"tx_addrs": bson.M{"$exists": false}}
+	return ctx.EachBatch(model.CollectionNameIrisTxMsg, query, 500, func(docs []bson.M) error {
+		hashes := make([]string, 0, len(docs))
+		for _, v := range docs {
+			if hash, ok := v["tx_hash"].(string); ok {
+				hashes = append(hashes, hash)
+			}
+		}
+		var txs []model.Tx
+		err := db.ExecCollection(model.CollectionNameIrisTx, func(c *mgo.Collection) error {
+			return c.Find(bson.M{"tx_hash": bson.M{"$in": hashes}}).
+				Select(bson.M{"tx_hash": 1, "addrs": 1, "signers": 1}).All(&txs)
+		})
+		if err != nil {
+			return err
+		}
+
+		return db.ExecCollection(model.CollectionNameIrisTxMsg, func(c *mgo.Collection) error {
+			for _, tx := range txs {
+				_, err := c.UpdateAll(bson.M{"tx_hash": tx.TxHash, "tx_addrs": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"tx_addrs": tx.Addrs, "tx_signers": tx.Signers}})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
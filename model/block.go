@@ -14,6 +14,7 @@ type (
 	Block struct {
 		Height     int64 `bson:"height"`
 		CreateTime int64 `bson:"create_time"`
+		TxNum      int64 `bson:"tx_num"` // num of txs in block, it's used to estimate work of task
 	}
 )
 
@@ -21,14 +22,14 @@ func (d Block) Name() string {
 	return CollectionNameBlock
 }
 
-func (d Block) EnsureIndexes() {
+func (d Block) Indexes() []mgo.Index {
 	var indexes []mgo.Index
 	indexes = append(indexes, mgo.Index{
 		Key:        []string{"-height"},
 		Unique:     true,
 		Background: true,
 	})
-	db.EnsureIndexes(d.Name(), indexes)
+	return indexes
 }
 
 func (d Block) PkKvPair() map[string]interface{} {
@@ -48,3 +49,39 @@ func (d Block) GetMaxBlockHeight() (Block, error) {
 
 	return result, nil
 }
+
+// average tx num of blocks whose height is in [from, to], blocks saved without tx num are skipped.
+// num of sampled blocks is returned too
+func (d Block) AvgTxNum(from, to int64) (float64, int, error) {
+	var res []struct {
+		Avg   float64 `bson:"avg"`
+		Count int     `bson:"count"`
+	}
+
+	q := []bson.M{
+		{"$match": bson.M{"height": bson.M{"$gte": from, "$lte": to}, "tx_num": bson.M{"$exists": true}}},
+		{"$group": bson.M{"_id": nil, "avg": bson.M{"$avg": "$tx_num"}, "count": bson.M{"$sum": 1}}},
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Pipe(q).All(&res)
+	}
+	if err := db.ExecCollection(d.Name(), fn); err != nil {
+		return 0, 0, err
+	}
+	if len(res) == 0 {
+		return 0, 0, nil
+	}
+	return res[0].Avg, res[0].Count, nil
+}
+
+func (d Block) GetBlockByHeight(height int64) (Block, error) {
+	var result Block
+
+	fn := func(c *mgo.Collection) error {
+		return c.Find(bson.M{"height": height}).One(&result)
+	}
+
+	err := db.ExecCollection(d.Name(), fn)
+	return result, err
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
+	"time"
+)
+
+const (
+	CollectionNameControl = "sync_iris_control"
+
+	controlIdWorkers = "workers"
+	controlIdPlanner = "planner"
+)
+
+// WorkersControl is shared switch of workers of all instances, workers don't execute tasks when paused
+type WorkersControl struct {
+	ID         string `bson:"_id" json:"-"`
+	Paused     bool   `bson:"paused" json:"paused"`
+	Reason     string `bson:"reason" json:"reason"`
+	UpdateTime int64  `bson:"update_time" json:"update_time"`
+}
+
+func (d WorkersControl) Name() string {
+	return CollectionNameControl
+}
+
+// get control of workers, workers aren't paused if it isn't set
+func (d WorkersControl) Get() (WorkersControl, error) {
+	var res WorkersControl
+	fn := func(c *mgo.Collection) error {
+		return c.FindId(controlIdWorkers).One(&res)
+	}
+	err := db.ExecCollection(d.Name(), fn)
+	if err == mgo.ErrNotFound {
+		return res, nil
+	}
+	return res, err
+}
+
+// pause or resume workers of all instances
+func (d WorkersControl) SetPaused(paused bool, reason string) (WorkersControl, error) {
+	res := WorkersControl{
+		ID:         controlIdWorkers,
+		Paused:     paused,
+		Reason:     reason,
+		UpdateTime: time.Now().Unix(),
+	}
+	fn := func(c *mgo.Collection) error {
+		_, err := c.UpsertId(controlIdWorkers, bson.M{"$set": bson.M{
+			"paused":      res.Paused,
+			"reason":      res.Reason,
+			"update_time": res.UpdateTime,
+		}})
+		return err
+	}
+	return res, db.ExecCollection(d.Name(), fn)
+}
+
+// PlannerLease is held by the only instance which plans tasks, it's taken over by other instance after it expires
+type PlannerLease struct {
+	ID              string `bson:"_id" json:"-"`
+	InstanceId      string `bson:"instance_id" json:"instance_id"`
+	LeaseExpireTime int64  `bson:"lease_expire_time" json:"lease_expire_time"` // unix timestamp
+	UpdateTime      int64  `bson:"update_time" json:"update_time"`
+	// increased whenever lease is taken over, tasks are created in txn asserting it
+	FencingToken int64 `bson:"fencing_token" json:"fencing_token"`
+}
+
+func (d PlannerLease) Name() string {
+	return CollectionNameControl
+}
+
+// get lease of planner, empty lease is returned if it has never been acquired
+func (d PlannerLease) Get() (PlannerLease, error) {
+	var res PlannerLease
+	fn := func(c *mgo.Collection) error {
+		return c.FindId(controlIdPlanner).One(&res)
+	}
+	err := db.ExecCollection(d.Name(), fn)
+	if err == mgo.ErrNotFound {
+		return res, nil
+	}
+	return res, err
+}
+
+// acquire or renew lease of planner for leaseDuration seconds, lease held by instance is returned.
+// false is returned if lease is held by other instance and hasn't expired
+func (d PlannerLease) Acquire(instanceId string, leaseDuration int64) (PlannerLease, bool, error) {
+	var res PlannerLease
+	now := time.Now().Unix()
+	set := bson.M{
+		"instance_id":       instanceId,
+		"lease_expire_time": now + leaseDuration,
+		"update_time":       now,
+	}
+	fn := func(c *mgo.Collection) error {
+		// renew lease held by instance, fencing token is kept because nobody else has taken it over
+		_, err := c.Find(renewSelector(instanceId)).Apply(mgo.Change{
+			Update:    bson.M{"$set": set},
+			ReturnNew: true,
+		}, &res)
+		if err != mgo.ErrNotFound {
+			return err
+		}
+		_, err = c.Find(takeOverSelector(now)).Apply(mgo.Change{
+			Update:    bson.M{"$set": set, "$inc": bson.M{"fencing_token": 1}},
+			Upsert:    true,
+			ReturnNew: true,
+		}, &res)
+		return err
+	}
+	err := db.ExecCollection(d.Name(), fn)
+	if mgo.IsDup(err) {
+		// lease exists and doesn't match selector, it's held by other instance
+		return res, false, nil
+	}
+	return res, err == nil, err
+}
+
+func renewSelector(instanceId string) bson.M {
+	return bson.M{"_id": controlIdPlanner, "instance_id": instanceId}
+}
+
+// expired lease is taken over, it's inserted if it doesn't exist
+func takeOverSelector(now int64) bson.M {
+	return bson.M{"_id": controlIdPlanner, "lease_expire_time": bson.M{"$lt": now}}
+}
+
+// op asserting lease is still held by instance with fencing token, txn of planner
+// fails once lease has been taken over by other instance
+func (d PlannerLease) FenceOp(instanceId string, fencingToken int64) txn.Op {
+	return txn.Op{
+		C:      d.Name(),
+		Id:     controlIdPlanner,
+		Assert: bson.M{"instance_id": instanceId, "fencing_token": fencingToken},
+	}
+}
+
+// release lease held by instance so that other instance takes it over at once
+func (d PlannerLease) Release(instanceId string) error {
+	fn := func(c *mgo.Collection) error {
+		return c.Update(bson.M{"_id": controlIdPlanner, "instance_id": instanceId},
+			bson.M{"$set": bson.M{"lease_expire_time": 0, "update_time": time.Now().Unix()}})
+	}
+	err := db.ExecCollection(d.Name(), fn)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
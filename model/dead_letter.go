@@ -0,0 +1,88 @@
+package model
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+const (
+	CollectionNameDeadLetter = "sync_iris_dead_letter"
+
+	// height is quarantined, its failed task waits for retry
+	DeadLetterStatusQuarantined = "quarantined"
+	// failed task of height is set unhandled by retry-quarantined command
+	DeadLetterStatusRetrying = "retrying"
+	// height is synced after retry
+	DeadLetterStatusResolved = "resolved"
+)
+
+// DeadLetter records height which keeps failing, one doc per height
+type DeadLetter struct {
+	ID          bson.ObjectId `bson:"_id"`
+	Height      int64         `bson:"height"`
+	TaskId      bson.ObjectId `bson:"task_id"` // failed task of the height
+	ErrKind     string        `bson:"err_kind"`
+	ErrStage    string        `bson:"err_stage"`
+	Error       string        `bson:"error"`
+	Attempts    int           `bson:"attempts"`    // failed attempts of all quarantines
+	Quarantines int           `bson:"quarantines"` // times the height is quarantined
+	Status      string        `bson:"status"`
+	CreateTime  int64         `bson:"create_time"`
+	UpdateTime  int64         `bson:"update_time"`
+}
+
+func (d DeadLetter) Name() string {
+	return CollectionNameDeadLetter
+}
+
+func (d DeadLetter) PkKvPair() map[string]interface{} {
+	return bson.M{"height": d.Height}
+}
+
+func (d DeadLetter) Indexes() []mgo.Index {
+	return []mgo.Index{
+		{
+			Key:        []string{"height"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"status"},
+			Background: true,
+		},
+	}
+}
+
+// get dead letter of height, mgo.ErrNotFound is returned if height isn't quarantined before
+func (d DeadLetter) GetByHeight(height int64) (DeadLetter, error) {
+	var res DeadLetter
+	fn := func(c *mgo.Collection) error {
+		return c.Find(bson.M{"height": height}).One(&res)
+	}
+	return res, db.ExecCollection(d.Name(), fn)
+}
+
+// query dead letters of status, all heights are queried if heights is empty
+func (d DeadLetter) QueryByStatus(status string, heights []int64) ([]DeadLetter, error) {
+	var res []DeadLetter
+	q := bson.M{"status": status}
+	if len(heights) > 0 {
+		q["height"] = bson.M{"$in": heights}
+	}
+	fn := func(c *mgo.Collection) error {
+		return c.Find(q).Sort("height").All(&res)
+	}
+	return res, db.ExecCollection(d.Name(), fn)
+}
+
+// mark retrying dead letter of height resolved, it's no-op if there is none
+func (d DeadLetter) Resolve(height int64) error {
+	fn := func(c *mgo.Collection) error {
+		_, err := c.UpdateAll(bson.M{"height": height, "status": DeadLetterStatusRetrying},
+			bson.M{"$set": bson.M{"status": DeadLetterStatusResolved, "update_time": time.Now().Unix()}})
+		return err
+	}
+	return db.ExecCollection(d.Name(), fn)
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	CollectionNameInstance = "sync_iris_instance"
+)
+
+// Instance is a running process of rainbow-sync, it's registered and kept alive by heartbeat
+type Instance struct {
+	ID            string `bson:"_id"` // instance id, hostname@xxx
+	Hostname      string `bson:"hostname"`
+	Pid           int    `bson:"pid"`
+	Version       string `bson:"version"`
+	ConfHash      string `bson:"conf_hash"`
+	StartTime     int64  `bson:"start_time"`
+	HeartbeatTime int64  `bson:"heartbeat_time"`
+	Workers       int    `bson:"workers"`      // running workers of executing task
+	MaxWorkers    int    `bson:"max_workers"`  // num of workers executing task configured by instance
+	ActiveTasks   int    `bson:"active_tasks"` // tasks owned by workers
+	PlannerLeader bool   `bson:"planner_leader"`
+	ChainHeight   int64  `bson:"chain_height"` // latest height of chain seen by instance
+}
+
+func (d Instance) Name() string {
+	return CollectionNameInstance
+}
+
+func (d Instance) PkKvPair() map[string]interface{} {
+	return bson.M{"_id": d.ID}
+}
+
+func (d Instance) Indexes() []mgo.Index {
+	return []mgo.Index{
+		{
+			Key:        []string{"-heartbeat_time"},
+			Background: true,
+		},
+	}
+}
+
+// register instance or update its heartbeat
+func (d Instance) Heartbeat(instance Instance) error {
+	fn := func(c *mgo.Collection) error {
+		_, err := c.UpsertId(instance.ID, instance)
+		return err
+	}
+	return db.ExecCollection(d.Name(), fn)
+}
+
+// remove instance which is stopped
+func (d Instance) Remove(id string) error {
+	fn := func(c *mgo.Collection) error {
+		return c.RemoveId(id)
+	}
+	err := db.ExecCollection(d.Name(), fn)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// remove instances whose heartbeat is before time, they are killed without removing themselves
+func (d Instance) RemoveStale(before int64) (int, error) {
+	var removed int
+	fn := func(c *mgo.Collection) error {
+		info, err := c.RemoveAll(bson.M{"heartbeat_time": bson.M{"$lt": before}})
+		if info != nil {
+			removed = info.Removed
+		}
+		return err
+	}
+	return removed, db.ExecCollection(d.Name(), fn)
+}
+
+// query registered instances ordered by start time, instances which are killed remain until they're pruned
+func (d Instance) QueryAll() ([]Instance, error) {
+	var res []Instance
+	fn := func(c *mgo.Collection) error {
+		return c.Find(nil).Sort("start_time").All(&res)
+	}
+	return res, db.ExecCollection(d.Name(), fn)
+}
@@ -1,9 +1,11 @@
 package model
 
 import (
+	"context"
 	"github.com/irisnet/rainbow-sync/db"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
 	"time"
 )
 
@@ -21,6 +23,17 @@ type (
 		WorkerId       string        `bson:"worker_id"`        // worker id
 		WorkerLogs     []WorkerLog   `bson:"worker_logs"`      // worker logs
 		LastUpdateTime int64         `bson:"last_update_time"` // unix timestamp
+
+		// worker owns task until lease expires, it's renewed by worker health check
+		LeaseExpireTime int64 `bson:"lease_expire_time"` // unix timestamp
+		// increased whenever task owner changes, commit of worker asserts it so that stale worker is fenced
+		FencingToken int64 `bson:"fencing_token"`
+		// task of higher priority is more likely to be executed by priority scheduling policy
+		Priority int `bson:"priority"`
+		// failed attempts of height next to current height, they are kept when task is taken over
+		// so that height which keeps failing is quarantined even if workers give up task
+		FailedHeight   int64 `bson:"failed_height"`
+		FailedAttempts int   `bson:"failed_attempts"`
 	}
 
 	WorkerLog struct {
@@ -37,7 +50,7 @@ func (d SyncTask) PkKvPair() map[string]interface{} {
 	return bson.M{"start_height": d.CurrentHeight, "end_height": d.EndHeight}
 }
 
-func (d SyncTask) EnsureIndexes() {
+func (d SyncTask) Indexes() []mgo.Index {
 	var indexes []mgo.Index
 	indexes = append(indexes, mgo.Index{
 		Key:        []string{"-start_height", "-end_height"},
@@ -47,7 +60,7 @@ func (d SyncTask) EnsureIndexes() {
 		Key:        []string{"-status"},
 		Background: true,
 	})
-	db.EnsureIndexes(d.Name(), indexes)
+	return indexes
 }
 
 // get max block height in sync task
@@ -118,18 +131,29 @@ func (d SyncTask) QueryAll(status []string, taskType string) ([]SyncTask, error)
 	return syncTasks, nil
 }
 
-func (d SyncTask) GetExecutableTask(maxWorkerSleepTime int64) ([]SyncTask, error) {
-	var tasks []SyncTask
+// get executable tasks, follow tasks are returned first and catch up tasks are sorted by sortFields
+func (d SyncTask) GetExecutableTask(maxWorkerSleepTime int64, sortFields ...string) ([]SyncTask, error) {
+	var tasks, catchUpTasks []SyncTask
 
-	t := time.Now().Add(time.Duration(-maxWorkerSleepTime) * time.Second).Unix()
-	q := bson.M{
-		"status": bson.M{
-			"$in": []string{db.SyncTaskStatusUnHandled, db.SyncTaskStatusUnderway},
-		},
+	now := time.Now().Unix()
+	status := bson.M{
+		"$in": []string{db.SyncTaskStatusUnHandled, db.SyncTaskStatusUnderway},
+	}
+	if len(sortFields) == 0 {
+		sortFields = []string{"-status"}
 	}
 
 	fn := func(c *mgo.Collection) error {
-		return c.Find(q).Sort("-status").Limit(1000).All(&tasks)
+		// query follow tasks apart so that they aren't cut off by limit of catch up tasks
+		if err := c.Find(bson.M{"status": status, "end_height": 0}).All(&tasks); err != nil {
+			return err
+		}
+		if err := c.Find(bson.M{"status": status, "end_height": bson.M{"$ne": 0}}).
+			Sort(sortFields...).Limit(1000).All(&catchUpTasks); err != nil {
+			return err
+		}
+		tasks = append(tasks, catchUpTasks...)
+		return nil
 	}
 
 	err := db.ExecCollection(d.Name(), fn)
@@ -139,9 +163,9 @@ func (d SyncTask) GetExecutableTask(maxWorkerSleepTime int64) ([]SyncTask, error
 	}
 
 	ret := make([]SyncTask, 0, len(tasks))
-	//filter the task which last_update_time >= now
+	//filter the underway task whose lease hasn't expired
 	for _, task := range tasks {
-		if task.LastUpdateTime >= t && task.Status == db.SyncTaskStatusUnderway {
+		if task.Status == db.SyncTaskStatusUnderway && !task.LeaseExpired(now, maxWorkerSleepTime) {
 			continue
 		}
 		ret = append(ret, task)
@@ -150,6 +174,15 @@ func (d SyncTask) GetExecutableTask(maxWorkerSleepTime int64) ([]SyncTask, error
 	return ret, nil
 }
 
+// whether lease of task has expired at now, task written before leases
+// has no lease expire time and it expires maxWorkerSleepTime after last update
+func (d SyncTask) LeaseExpired(now, maxWorkerSleepTime int64) bool {
+	if d.LeaseExpireTime == 0 {
+		return d.LastUpdateTime+maxWorkerSleepTime < now
+	}
+	return d.LeaseExpireTime <= now
+}
+
 func (d SyncTask) GetTaskById(id bson.ObjectId) (SyncTask, error) {
 	var task SyncTask
 
@@ -183,45 +216,95 @@ func (d SyncTask) GetTaskByIdAndWorker(id bson.ObjectId, worker string) (SyncTas
 	return task, nil
 }
 
-// take over a task
-// update status, worker_id, worker_logs and last_update_time
-func (d SyncTask) TakeOverTask(task SyncTask, workerId string) error {
+// take over a task with lease of leaseDuration seconds
+// update status, worker_id, worker_logs, last_update_time, lease and increase fencing token.
+// task owned by worker is returned
+func (d SyncTask) TakeOverTask(task SyncTask, workerId string, leaseDuration int64) (SyncTask, error) {
 	// multiple goroutine attempt to update same record,
 	// use this selector to ensure only one goroutine can update success at same time
 	fn := func(c *mgo.Collection) error {
-		selector := bson.M{
-			"_id":              task.ID,
-			"last_update_time": task.LastUpdateTime,
-		}
+		selector := d.TakeOverSelector(task)
 
+		now := time.Now()
 		task.Status = db.SyncTaskStatusUnderway
 		task.WorkerId = workerId
-		task.LastUpdateTime = time.Now().Unix()
+		task.LastUpdateTime = now.Unix()
+		task.LeaseExpireTime = now.Unix() + leaseDuration
+		task.FencingToken++
 		task.WorkerLogs = append(task.WorkerLogs, WorkerLog{
 			WorkerId:  workerId,
-			BeginTime: time.Now(),
+			BeginTime: now,
 		})
 
 		return c.Update(selector, task)
 	}
 
-	return db.ExecCollection(d.Name(), fn)
+	return task, db.ExecCollection(d.Name(), fn)
+}
+
+// selector of task which hasn't been updated since it's read
+func (d SyncTask) TakeOverSelector(task SyncTask) bson.M {
+	return bson.M{
+		"_id":              task.ID,
+		"last_update_time": task.LastUpdateTime,
+		"fencing_token":    fencingTokenSelector(task.FencingToken),
+	}
 }
 
-// update task last update time
-func (d SyncTask) UpdateLastUpdateTime(task SyncTask) error {
+// fencing token of task written before leases doesn't exist
+func fencingTokenSelector(token int64) interface{} {
+	if token == 0 {
+		return bson.M{"$in": []interface{}{0, nil}}
+	}
+	return token
+}
+
+// selector of task which is still owned by worker, it doesn't match once task
+// has been taken over, released or invalidated because fencing token is increased
+func (d SyncTask) OwnerSelector(task SyncTask) bson.M {
+	return bson.M{
+		"_id":           task.ID,
+		"worker_id":     task.WorkerId,
+		"fencing_token": task.FencingToken,
+	}
+}
+
+// op updating progress of task owned by worker in txn of block docs,
+// commit of worker whose task has been taken over or released is rejected
+func (d SyncTask) CommitOp(task SyncTask) txn.Op {
+	return txn.Op{
+		C:      d.Name(),
+		Id:     task.ID,
+		Assert: bson.M{"worker_id": task.WorkerId, "fencing_token": task.FencingToken},
+		Update: bson.M{
+			"$set": bson.M{
+				"current_height":   task.CurrentHeight,
+				"status":           task.Status,
+				"last_update_time": task.LastUpdateTime,
+			},
+		},
+	}
+}
+
+// renew lease of task owned by worker for leaseDuration seconds, last update time is updated too.
+// mgo.ErrNotFound is returned if task has been taken over, released or invalidated
+func (d SyncTask) RenewLease(task SyncTask, leaseDuration int64) (SyncTask, error) {
 	fn := func(c *mgo.Collection) error {
-		selector := bson.M{
-			"_id":       task.ID,
-			"worker_id": task.WorkerId,
-		}
+		selector := d.OwnerSelector(task)
 
-		task.LastUpdateTime = time.Now().Unix()
+		now := time.Now().Unix()
+		task.LastUpdateTime = now
+		task.LeaseExpireTime = now + leaseDuration
 
-		return c.Update(selector, task)
+		return c.Update(selector, bson.M{
+			"$set": bson.M{
+				"last_update_time":  task.LastUpdateTime,
+				"lease_expire_time": task.LeaseExpireTime,
+			},
+		})
 	}
 
-	return db.ExecCollection(d.Name(), fn)
+	return task, db.ExecCollection(d.Name(), fn)
 }
 
 // query valid follow way
@@ -251,3 +334,230 @@ func (d SyncTask) QueryValidFollowTasks() (bool, error) {
 
 	return false, nil
 }
+
+// count tasks group by status
+func (d SyncTask) CountByStatus() (map[string]int, error) {
+	var res []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	q := []bson.M{
+		{
+			"$group": bson.M{
+				"_id":   "$status",
+				"count": bson.M{"$sum": 1},
+			},
+		},
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Pipe(q).All(&res)
+	}
+	if err := db.ExecCollection(d.Name(), fn); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(res))
+	for _, v := range res {
+		counts[v.Status] = v.Count
+	}
+	return counts, nil
+}
+
+// num of heights of catch up tasks and synced heights of them
+func (d SyncTask) CatchUpProgress() (total, synced int64, err error) {
+	var res []struct {
+		Total  int64 `bson:"total"`
+		Synced int64 `bson:"synced"`
+	}
+	heights := bson.M{"$subtract": []interface{}{bson.M{"$add": []interface{}{"$end_height", 1}}, "$start_height"}}
+	syncedHeights := bson.M{"$cond": []interface{}{
+		bson.M{"$eq": []interface{}{"$status", db.SyncTaskStatusCompleted}},
+		heights,
+		bson.M{"$cond": []interface{}{
+			bson.M{"$gte": []interface{}{"$current_height", "$start_height"}},
+			bson.M{"$subtract": []interface{}{bson.M{"$add": []interface{}{"$current_height", 1}}, "$start_height"}},
+			0,
+		}},
+	}}
+	q := []bson.M{
+		{"$match": bson.M{"end_height": bson.M{"$ne": 0}}},
+		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": heights}, "synced": bson.M{"$sum": syncedHeights}}},
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Pipe(q).All(&res)
+	}
+	if err := db.ExecCollection(d.Name(), fn); err != nil {
+		return 0, 0, err
+	}
+	if len(res) == 0 {
+		return 0, 0, nil
+	}
+	return res[0].Total, res[0].Synced, nil
+}
+
+// position of task in list, start height isn't unique so that id breaks ties
+type TaskPosition struct {
+	StartHeight int64
+	ID          bson.ObjectId
+}
+
+// list tasks ordered by start height and id desc, only tasks before position are listed if it isn't nil
+func (d SyncTask) ListTasks(status, taskType string, before *TaskPosition, limit int) ([]SyncTask, error) {
+	var tasks []SyncTask
+	q := bson.M{}
+	if status != "" {
+		q["status"] = status
+	}
+	switch taskType {
+	case db.SyncTaskTypeCatchUp:
+		q["end_height"] = bson.M{"$ne": 0}
+	case db.SyncTaskTypeFollow:
+		q["end_height"] = 0
+	}
+	if before != nil {
+		q["$or"] = []bson.M{
+			{"start_height": bson.M{"$lt": before.StartHeight}},
+			{"start_height": before.StartHeight, "_id": bson.M{"$lt": before.ID}},
+		}
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Find(q).Sort("-start_height", "-_id").Limit(limit).All(&tasks)
+	}
+	err := db.ExecCollection(d.Name(), fn)
+	return tasks, err
+}
+
+// failed attempts of height which is synced by task next
+func (d SyncTask) FailedAttemptsOf(height int64) int {
+	if d.FailedHeight != height {
+		return 0
+	}
+	return d.FailedAttempts
+}
+
+// record failed attempts of height in task owned by worker.
+// mgo.ErrNotFound is returned if task isn't owned by worker
+func (d SyncTask) RecordFailure(task SyncTask, height int64, attempts int) (SyncTask, error) {
+	fn := func(c *mgo.Collection) error {
+		return c.Update(d.OwnerSelector(task), bson.M{
+			"$set": bson.M{"failed_height": height, "failed_attempts": attempts},
+		})
+	}
+	task.FailedHeight, task.FailedAttempts = height, attempts
+	return task, db.ExecCollection(d.Name(), fn)
+}
+
+// release task held by worker, so that it can be taken over by other worker at once.
+// like TakeOverTask, mgo.ErrNotFound is returned if task has been updated since it's read
+func (d SyncTask) ReleaseTask(task SyncTask) error {
+	fn := func(c *mgo.Collection) error {
+		selector := bson.M{
+			"_id":              task.ID,
+			"status":           db.SyncTaskStatusUnderway,
+			"worker_id":        task.WorkerId,
+			"last_update_time": task.LastUpdateTime,
+		}
+		return c.Update(selector, bson.M{
+			"$set": bson.M{
+				"status":            db.SyncTaskStatusUnHandled,
+				"worker_id":         "",
+				"last_update_time":  time.Now().Unix(),
+				"lease_expire_time": 0,
+			},
+			// commit of released worker is rejected
+			"$inc": bson.M{"fencing_token": 1},
+		})
+	}
+
+	return db.ExecCollection(d.Name(), fn)
+}
+
+// hand task owned by worker back as unhandled, current height is kept so that
+// next worker goes on with it. mgo.ErrNotFound is returned if task isn't owned by worker
+func (d SyncTask) ReleaseOwnTask(task SyncTask) error {
+	fn := func(c *mgo.Collection) error {
+		selector := d.OwnerSelector(task)
+		selector["status"] = db.SyncTaskStatusUnderway
+		return c.Update(selector, bson.M{
+			"$set": bson.M{
+				"status":            db.SyncTaskStatusUnHandled,
+				"worker_id":         "",
+				"last_update_time":  time.Now().Unix(),
+				"lease_expire_time": 0,
+			},
+			// commit of released worker is rejected
+			"$inc": bson.M{"fencing_token": 1},
+		})
+	}
+
+	return db.ExecCollection(d.Name(), fn)
+}
+
+// mark follow task invalid, worker of it quits because worker id is cleared.
+// mgo.ErrNotFound is returned if task has been updated since it's read
+func (d SyncTask) InvalidateFollowTask(task SyncTask) error {
+	fn := func(c *mgo.Collection) error {
+		selector := bson.M{
+			"_id":              task.ID,
+			"end_height":       0,
+			"status":           bson.M{"$in": []string{db.SyncTaskStatusUnHandled, db.SyncTaskStatusUnderway}},
+			"last_update_time": task.LastUpdateTime,
+		}
+		return c.Update(selector, bson.M{
+			"$set": bson.M{
+				"status":            db.FollowTaskStatusInvalid,
+				"worker_id":         "",
+				"last_update_time":  time.Now().Unix(),
+				"lease_expire_time": 0,
+			},
+			"$inc": bson.M{"fencing_token": 1},
+		})
+	}
+
+	return db.ExecCollection(d.Name(), fn)
+}
+
+// set priority of task
+func (d SyncTask) SetPriority(task SyncTask, priority int) error {
+	fn := func(c *mgo.Collection) error {
+		return c.UpdateId(task.ID, bson.M{"$set": bson.M{"priority": priority}})
+	}
+
+	return db.ExecCollection(d.Name(), fn)
+}
+
+// split unhandled catch up task at height, task ends at height and new task from height+1 to end is created.
+// new task is returned, txn fails if task has been updated since it's read
+func (d SyncTask) SplitTask(ctx context.Context, task SyncTask, height int64) (SyncTask, error) {
+	now := time.Now().Unix()
+	newTask := SyncTask{
+		ID:             bson.NewObjectId(),
+		StartHeight:    height + 1,
+		EndHeight:      task.EndHeight,
+		Status:         db.SyncTaskStatusUnHandled,
+		LastUpdateTime: now,
+		Priority:       task.Priority,
+	}
+	ops := []txn.Op{
+		{
+			// last update time is changed so that worker which has read task can't take over it
+			C:  d.Name(),
+			Id: task.ID,
+			Assert: bson.M{
+				"status":           db.SyncTaskStatusUnHandled,
+				"end_height":       task.EndHeight,
+				"last_update_time": task.LastUpdateTime,
+			},
+			Update: bson.M{"$set": bson.M{"end_height": height, "last_update_time": now}},
+		},
+		{
+			C:      d.Name(),
+			Id:     newTask.ID,
+			Insert: newTask,
+		},
+	}
+	return newTask, db.Txn(ctx, ops)
+}
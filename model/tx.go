@@ -55,7 +55,7 @@ func (d Tx) PkKvPair() map[string]interface{} {
 	return bson.M{"height": d.Height, "tx_index": d.TxIndex}
 }
 
-func (d Tx) EnsureIndexes() {
+func (d Tx) Indexes() []mgo.Index {
 	var indexes []mgo.Index
 	indexes = append(indexes,
 		mgo.Index{
@@ -66,7 +66,52 @@ func (d Tx) EnsureIndexes() {
 			Key:        []string{"-tx_hash"},
 			Unique:     true,
 			Background: true},
+		// address history of api, paginated by tx id
+		mgo.Index{
+			Key:        []string{"addrs", "-tx_id"},
+			Background: true},
+		mgo.Index{
+			Key:        []string{"signers", "-tx_id"},
+			Background: true},
+		mgo.Index{
+			Key:        []string{"types", "-tx_id"},
+			Background: true},
+		mgo.Index{
+			Key:        []string{"-time"},
+			Background: true},
 	)
+	return indexes
+}
+
+func (d Tx) GetTxByHash(hash string) (Tx, error) {
+	var tx Tx
+	fn := func(c *mgo.Collection) error {
+		return c.Find(bson.M{"tx_hash": hash}).One(&tx)
+	}
+
+	err := db.ExecCollection(d.Name(), fn)
+	return tx, err
+}
+
+// query txs which contain addr or are signed by signer, ordered by tx id desc,
+// only txs whose tx id less than beforeTxId are returned if it's greater than 0
+func (d Tx) QueryTxsByAddr(addr, signer string, beforeTxId uint64, limit int) ([]Tx, error) {
+	var txs []Tx
+	q := bson.M{}
+	if addr != "" {
+		q["addrs"] = addr
+	}
+	if signer != "" {
+		q["signers"] = signer
+	}
+	if beforeTxId > 0 {
+		q["tx_id"] = bson.M{"$lt": beforeTxId}
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Find(q).Sort("-tx_id").Limit(limit).All(&txs)
+	}
 
-	db.EnsureIndexes(d.Name(), indexes)
+	err := db.ExecCollection(d.Name(), fn)
+	return txs, err
 }
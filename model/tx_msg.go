@@ -42,14 +42,82 @@ func (d TxMsg) PkKvPair() map[string]interface{} {
 	return bson.M{"tx_hash": d.TxHash, "msg_index": d.MsgIndex}
 }
 
-func (d TxMsg) EnsureIndexes() {
+func (d TxMsg) Indexes() []mgo.Index {
 	var indexes []mgo.Index
 	indexes = append(indexes,
 		mgo.Index{
 			Key:        []string{"-tx_hash", "-msg_index"},
 			Unique:     true,
 			Background: true},
+		// msgs by type and denom of api, paginated by position of msg
+		mgo.Index{
+			Key:        []string{"type", "-height", "-tx_index", "-msg_index"},
+			Background: true},
+		mgo.Index{
+			Key:        []string{"denoms", "-height", "-tx_index", "-msg_index"},
+			Background: true},
+		mgo.Index{
+			Key:        []string{"addrs", "-height", "-tx_index", "-msg_index"},
+			Background: true},
+		// change feed reads msgs in order of position
+		mgo.Index{
+			Key:        []string{"height", "tx_index", "msg_index"},
+			Background: true},
 	)
+	return indexes
+}
+
+// position of msg in chain, msgs are paginated by it
+type MsgPosition struct {
+	Height   int64
+	TxIndex  uint32
+	MsgIndex int
+}
+
+// query msgs of type and denom, ordered by position desc,
+// only msgs before position are returned if it isn't nil
+func (d TxMsg) QueryMsgsByTypeAndDenom(msgType, denom string, before *MsgPosition, limit int) ([]TxMsg, error) {
+	var msgs []TxMsg
+	q := bson.M{}
+	if msgType != "" {
+		q["type"] = msgType
+	}
+	if denom != "" {
+		q["denoms"] = denom
+	}
+	if before != nil {
+		q["$or"] = []bson.M{
+			{"height": bson.M{"$lt": before.Height}},
+			{"height": before.Height, "tx_index": bson.M{"$lt": before.TxIndex}},
+			{"height": before.Height, "tx_index": before.TxIndex, "msg_index": bson.M{"$lt": before.MsgIndex}},
+		}
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Find(q).Sort("-height", "-tx_index", "-msg_index").Limit(limit).All(&msgs)
+	}
+
+	err := db.ExecCollection(d.Name(), fn)
+	return msgs, err
+}
+
+// query msgs after position whose height isn't greater than maxHeight, ordered by position asc,
+// msgs are queried from the first one if after is nil
+func (d TxMsg) QueryMsgsAfter(after *MsgPosition, maxHeight int64, limit int) ([]TxMsg, error) {
+	var msgs []TxMsg
+	q := bson.M{"height": bson.M{"$lte": maxHeight}}
+	if after != nil {
+		q["$or"] = []bson.M{
+			{"height": bson.M{"$gt": after.Height}},
+			{"height": after.Height, "tx_index": bson.M{"$gt": after.TxIndex}},
+			{"height": after.Height, "tx_index": after.TxIndex, "msg_index": bson.M{"$gt": after.MsgIndex}},
+		}
+	}
+
+	fn := func(c *mgo.Collection) error {
+		return c.Find(q).Sort("height", "tx_index", "msg_index").Limit(limit).All(&msgs)
+	}
 
-	db.EnsureIndexes(d.Name(), indexes)
+	err := db.ExecCollection(d.Name(), fn)
+	return msgs, err
 }
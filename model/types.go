@@ -3,22 +3,24 @@ package model
 import "github.com/irisnet/rainbow-sync/db"
 
 var (
-	SyncTaskModel SyncTask
-	BlockModel    Block
-	TxModel       Tx
+	SyncTaskModel       SyncTask
+	BlockModel          Block
+	TxModel             Tx
+	DeadLetterModel     DeadLetter
+	WorkersControlModel WorkersControl
+	PlannerLeaseModel   PlannerLease
+	InstanceModel       Instance
 
 	Collections = []db.Docs{
 		SyncTaskModel,
 		BlockModel,
 		TxModel,
 		new(TxMsg),
+		DeadLetterModel,
+		InstanceModel,
 	}
 )
 
 func EnsureDocsIndexes() {
-	if len(Collections) > 0 {
-		for _, v := range Collections {
-			v.EnsureIndexes()
-		}
-	}
+	db.ReconcileIndexes(Collections)
 }
@@ -7,9 +7,6 @@ import (
 	"github.com/irisnet/rainbow-sync/lib/pool"
 	"github.com/irisnet/rainbow-sync/model"
 	"github.com/irisnet/rainbow-sync/monitor/metrics"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 )
 
@@ -23,11 +20,13 @@ const (
 )
 
 type clientNode struct {
-	nodeStatus  metrics.Guage
-	nodeHeight  metrics.Guage
-	dbHeight    metrics.Guage
-	nodeTimeGap metrics.Guage
-	syncWorkWay metrics.Guage
+	nodeStatus      metrics.Guage
+	nodeHeight      metrics.Guage
+	dbHeight        metrics.Guage
+	nodeTimeGap     metrics.Guage
+	syncWorkWay     metrics.Guage
+	endPointState   metrics.Guage
+	endPointLatency metrics.Guage
 }
 
 func NewMetricNode(server metrics.Monitor) clientNode {
@@ -66,32 +65,60 @@ func NewMetricNode(server metrics.Monitor) clientNode {
 		"sync task working status(0:CatchingUp 1:Following)",
 		nil,
 	)
-	server.RegisterMetrics(nodeHeightMetric, dbHeightMetric, nodeStatusMetric, nodeTimeGapMetric, syncWorkwayMetric)
+	endPointStateMetric := metrics.NewGuage(
+		"sync",
+		"pool",
+		"endpoint_state",
+		"circuit breaker state of rpc node in client pool(0:Closed,1:HalfOpen,2:Open)",
+		[]string{"endpoint"},
+	)
+	endPointLatencyMetric := metrics.NewGuage(
+		"sync",
+		"pool",
+		"endpoint_latency_seconds",
+		"observed latency of rpc node in client pool",
+		[]string{"endpoint"},
+	)
+	server.RegisterMetrics(nodeHeightMetric, dbHeightMetric, nodeStatusMetric, nodeTimeGapMetric, syncWorkwayMetric,
+		endPointStateMetric, endPointLatencyMetric)
 	nodeHeight, _ := metrics.CovertGuage(nodeHeightMetric)
 	dbHeight, _ := metrics.CovertGuage(dbHeightMetric)
 	nodeStatus, _ := metrics.CovertGuage(nodeStatusMetric)
 	nodeTimeGap, _ := metrics.CovertGuage(nodeTimeGapMetric)
 	syncWorkway, _ := metrics.CovertGuage(syncWorkwayMetric)
+	endPointState, _ := metrics.CovertGuage(endPointStateMetric)
+	endPointLatency, _ := metrics.CovertGuage(endPointLatencyMetric)
 	return clientNode{
-		nodeStatus:  nodeStatus,
-		nodeHeight:  nodeHeight,
-		dbHeight:    dbHeight,
-		nodeTimeGap: nodeTimeGap,
-		syncWorkWay: syncWorkway,
+		nodeStatus:      nodeStatus,
+		nodeHeight:      nodeHeight,
+		dbHeight:        dbHeight,
+		nodeTimeGap:     nodeTimeGap,
+		syncWorkWay:     syncWorkway,
+		endPointState:   endPointState,
+		endPointLatency: endPointLatency,
 	}
 }
 
-func (node *clientNode) Report() {
+func (node *clientNode) Report(ctx context.Context) {
 	for {
 		t := time.NewTimer(time.Duration(10) * time.Second)
 		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
 		case <-t.C:
 			node.nodeStatusReport()
 		}
 	}
 }
 func (node *clientNode) nodeStatusReport() {
-	client, err := pool.GetClientWithTimeout(10 * time.Second)
+	if conf.SvrConf.SyncSource != conf.SyncSourceRpc {
+		// there is no rpc node when sync from dump or archive
+		node.dbHeightReport()
+		return
+	}
+	node.endPointReport()
+	client, err := pool.GetClientWithTimeout(conf.NodeRoleTip, 10*time.Second)
 	if err != nil {
 		logger.Error("rpc node connection exception", logger.String("error", err.Error()))
 		node.nodeStatus.Set(float64(NodeStatusNotReachable))
@@ -138,16 +165,29 @@ func (node *clientNode) nodeStatusReport() {
 	return
 }
 
-func Start() {
-	c := make(chan os.Signal)
-	//monitor system signal
-	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	// start monitor
+func (node *clientNode) dbHeightReport() {
+	block, err := new(model.Block).GetMaxBlockHeight()
+	if err != nil {
+		logger.Error("query block exception", logger.String("error", err.Error()))
+	}
+	node.dbHeight.Set(float64(block.Height))
+}
+
+func (node *clientNode) endPointReport() {
+	for _, v := range pool.EndPoints() {
+		node.endPointState.With("endpoint", v.Address).Set(float64(v.State))
+		node.endPointLatency.With("endpoint", v.Address).Set(v.Latency.Seconds())
+	}
+}
+
+// start monitor, metrics are reported until ctx is done
+func Start(ctx context.Context) {
 	server := metrics.NewMonitor(conf.SvrConf.PromethousPort)
 	node := NewMetricNode(server)
 
-	server.Report(func() {
-		go node.Report()
+	// metrics server of sdk never returns
+	go server.Report(func() {
+		go node.Report(ctx)
 	})
-	<-c
+	<-ctx.Done()
 }
@@ -0,0 +1,38 @@
+package task
+
+import (
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"sync"
+	"time"
+)
+
+// control of workers is read from db at most once in controlRefreshInterval
+const controlRefreshInterval = 5 * time.Second
+
+var workersControl struct {
+	sync.Mutex
+	paused    bool
+	refreshAt time.Time
+}
+
+// whether workers are paused by admin api, last known state is kept if db read fails
+func workersPaused() bool {
+	workersControl.Lock()
+	defer workersControl.Unlock()
+	if time.Now().Before(workersControl.refreshAt) {
+		return workersControl.paused
+	}
+	workersControl.refreshAt = time.Now().Add(controlRefreshInterval)
+	control, err := imodel.WorkersControlModel.Get()
+	if err != nil {
+		logger.Error("get workers control fail", logger.String("err", err.Error()))
+		return workersControl.paused
+	}
+	if control.Paused != workersControl.paused {
+		logger.Info("workers control changed", logger.Bool("paused", control.Paused),
+			logger.String("reason", control.Reason))
+	}
+	workersControl.paused = control.Paused
+	return workersControl.paused
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"github.com/irisnet/rainbow-sync/conf"
 	model "github.com/irisnet/rainbow-sync/db"
@@ -8,16 +9,19 @@ import (
 	imodel "github.com/irisnet/rainbow-sync/model"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/mgo.v2/txn"
+	"sync"
 	"time"
 )
 
 type TaskIrisService struct {
 	syncIrisModel imodel.SyncTask
+	// running goroutines of creating or executing task
+	wg sync.WaitGroup
 }
 
 const maxRecordNumForBatchInsert = 1000
 
-func (s *TaskIrisService) StartCreateTask() {
+func (s *TaskIrisService) StartCreateTask(ctx context.Context) {
 	blockNumPerWorkerHandle := int64(conf.SvrConf.BlockNumPerWorkerHandle)
 
 	logger.Info("Start create task")
@@ -25,14 +29,44 @@ func (s *TaskIrisService) StartCreateTask() {
 	// buffer channel to limit goroutine num
 	chanLimit := make(chan bool, conf.SvrConf.WorkerNumCreateTask)
 
+	// only leader of planner creates tasks
+	renewPlannerLease()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		keepPlannerLease(ctx)
+	}()
+
 	for {
-		chanLimit <- true
-		go s.createTask(blockNumPerWorkerHandle, chanLimit)
-		time.Sleep(time.Duration(1) * time.Minute)
+		select {
+		case <-ctx.Done():
+			logger.Info("Stop create task")
+			return
+		case chanLimit <- true:
+		}
+		if ctx.Err() != nil {
+			// select may take send though ctx is done
+			<-chanLimit
+			logger.Info("Stop create task")
+			return
+		}
+		if isPlannerLeader() {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.createTask(ctx, blockNumPerWorkerHandle, chanLimit)
+			}()
+		} else {
+			<-chanLimit
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(1) * time.Minute):
+		}
 	}
 }
 
-func (s *TaskIrisService) createTask(blockNumPerWorkerHandle int64, chanLimit chan bool) {
+func (s *TaskIrisService) createTask(ctx context.Context, blockNumPerWorkerHandle int64, chanLimit chan bool) {
 	var (
 		syncIrisTasks     []*imodel.SyncTask
 		ops               []txn.Op
@@ -72,7 +106,8 @@ func (s *TaskIrisService) createTask(blockNumPerWorkerHandle int64, chanLimit ch
 		}
 
 		if maxEndHeight+blockNumPerWorkerHandle <= blockChainLatestHeight {
-			syncIrisTasks = createCatchUpTask(maxEndHeight, blockNumPerWorkerHandle, blockChainLatestHeight)
+			syncIrisTasks = createCatchUpTask(maxEndHeight, blockNumPerWorkerHandle, blockChainLatestHeight,
+				catchUpTaskSize)
 			logMsg = fmt.Sprintf("Create  catch up task during follow task not exist,from-to:%v-%v",
 				maxEndHeight+1, blockChainLatestHeight)
 		} else {
@@ -81,7 +116,15 @@ func (s *TaskIrisService) createTask(blockNumPerWorkerHandle int64, chanLimit ch
 				logger.Error("AssertAllCatchUpTaskFinished failed", logger.String("err", err.Error()))
 				return
 			}
-			if finished {
+			if conf.SvrConf.SyncSource != conf.SyncSourceRpc {
+				// there is no chain tip to follow, create catch up task for the rest heights of dump or archive
+				if maxEndHeight < blockChainLatestHeight {
+					syncIrisTasks = createCatchUpTask(maxEndHeight, 1, blockChainLatestHeight,
+						catchUpTaskSize)
+					logMsg = fmt.Sprintf("Create catch up task for rest heights of %v,from-to:%v-%v",
+						conf.SvrConf.SyncSource, maxEndHeight+1, blockChainLatestHeight)
+				}
+			} else if finished {
 				syncIrisTasks = createFollowTask(maxEndHeight, blockNumPerWorkerHandle, blockChainLatestHeight)
 				logMsg = fmt.Sprintf("Create follow task during follow task not exist,from-to:%v-%v",
 					maxEndHeight+1, blockChainLatestHeight)
@@ -101,7 +144,8 @@ func (s *TaskIrisService) createTask(blockNumPerWorkerHandle int64, chanLimit ch
 		}
 
 		if followedHeight+blockNumPerWorkerHandle <= blockChainLatestHeight {
-			syncIrisTasks = createCatchUpTask(followedHeight, blockNumPerWorkerHandle, blockChainLatestHeight)
+			syncIrisTasks = createCatchUpTask(followedHeight, blockNumPerWorkerHandle, blockChainLatestHeight,
+				catchUpTaskSize)
 
 			invalidFollowTask = followTask
 			logMsg = fmt.Sprintf("Create catch up task during follow task exist,from-to:%v-%v,invalidFollowTaskId:%v,invalidFollowTaskCurHeight:%v",
@@ -146,18 +190,30 @@ func (s *TaskIrisService) createTask(blockNumPerWorkerHandle int64, chanLimit ch
 	}
 
 	if len(ops) > 0 {
-		err := model.Txn(ops)
+		fencingToken, ok := plannerFencingToken()
+		if !ok {
+			// lease is lost during planning
+			return
+		}
+		// txn fails if lease has been taken over by other instance since it's acquired
+		ops = append(ops, imodel.PlannerLeaseModel.FenceOp(InstanceId, fencingToken))
+		err := model.Txn(ctx, ops)
 		if err != nil {
 			logger.Warn("Create sync task fail", logger.String("err", err.Error()))
 		} else {
 			logger.Info(fmt.Sprintf("Create sync task success,%v", logMsg))
 		}
 	}
+	s.splitOversizedTasks(ctx)
 
 	time.Sleep(1 * time.Second)
 }
 
-func createCatchUpTask(maxEndHeight, blockNumPerWorker, currentBlockHeight int64) []*imodel.SyncTask {
+// create catch up tasks after maxEndHeight until less than blockNumPerWorker blocks are left,
+// each task has sizeAt(height) blocks after height it starts from, last task ends at currentBlockHeight
+// if it's shorter than that
+func createCatchUpTask(maxEndHeight, blockNumPerWorker, currentBlockHeight int64,
+	sizeAt func(height int64) int64) []*imodel.SyncTask {
 	var (
 		syncTasks []*imodel.SyncTask
 	)
@@ -169,15 +225,19 @@ func createCatchUpTask(maxEndHeight, blockNumPerWorker, currentBlockHeight int64
 		if len(syncTasks) >= maxRecordNumForBatchInsert {
 			break
 		}
+		endHeight := maxEndHeight + sizeAt(maxEndHeight)
+		if endHeight > currentBlockHeight {
+			endHeight = currentBlockHeight
+		}
 		syncTask := imodel.SyncTask{
 			StartHeight:    maxEndHeight + 1,
-			EndHeight:      maxEndHeight + blockNumPerWorker,
+			EndHeight:      endHeight,
 			Status:         model.SyncTaskStatusUnHandled,
 			LastUpdateTime: time.Now().Unix(),
 		}
 		syncTasks = append(syncTasks, &syncTask)
 
-		maxEndHeight += blockNumPerWorker
+		maxEndHeight = endHeight
 	}
 
 	return syncTasks
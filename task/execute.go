@@ -2,22 +2,27 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/irisnet/rainbow-sync/block"
 	"github.com/irisnet/rainbow-sync/conf"
 	model "github.com/irisnet/rainbow-sync/db"
 	"github.com/irisnet/rainbow-sync/lib/logger"
 	"github.com/irisnet/rainbow-sync/lib/pool"
+	"github.com/irisnet/rainbow-sync/lib/retry"
+	"github.com/irisnet/rainbow-sync/lib/tracing"
 	imodel "github.com/irisnet/rainbow-sync/model"
 	"github.com/irisnet/rainbow-sync/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
 	"os"
-	"strings"
+	"sync/atomic"
 	"time"
 )
 
-func (s *TaskIrisService) StartExecuteTask() {
+func (s *TaskIrisService) StartExecuteTask(ctx context.Context) {
 	var (
 		blockNumPerWorkerHandle = int64(conf.SvrConf.BlockNumPerWorkerHandle)
 		workerMaxSleepTime      = int64(conf.SvrConf.WorkerMaxSleepTime)
@@ -32,13 +37,44 @@ func (s *TaskIrisService) StartExecuteTask() {
 	chanLimit := make(chan bool, conf.SvrConf.WorkerNumExecuteTask)
 
 	for {
-		chanLimit <- true
-		go s.executeTask(blockNumPerWorkerHandle, workerMaxSleepTime, chanLimit)
-		time.Sleep(time.Duration(1) * time.Second)
+		if workersPaused() {
+			// no task is taken over until workers are resumed
+			if !sleepCtx(ctx, controlRefreshInterval) {
+				break
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case chanLimit <- true:
+			if ctx.Err() != nil {
+				// select may take send though ctx is done
+				<-chanLimit
+				break
+			}
+			s.wg.Add(1)
+			go s.executeTask(ctx, blockNumPerWorkerHandle, workerMaxSleepTime, chanLimit)
+		}
+		if !sleepCtx(ctx, time.Duration(1)*time.Second) {
+			break
+		}
 	}
+	logger.Info("Stop execute task")
 }
 
-func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTime int64, chanLimit chan bool) {
+// sleep for d, return false if ctx is done before that
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// execute a task until it's finished or ctx is done,
+// task is released when ctx is done after current height is handled
+func (s *TaskIrisService) executeTask(shutdown context.Context, blockNumPerWorkerHandle, maxWorkerSleepTime int64, chanLimit chan bool) {
 	var (
 		workerId, taskType     string
 		blockChainLatestHeight int64
@@ -51,7 +87,12 @@ func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTim
 
 	healthCheckQuit := make(chan bool)
 	workerId = genWorkerId()
-	client := pool.GetClient()
+	atomic.AddInt64(&runningWorkers, 1)
+	defer atomic.AddInt64(&runningWorkers, -1)
+	var (
+		source    block.Source
+		rpcSource *block.RpcSource
+	)
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -59,24 +100,33 @@ func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTim
 		}
 		close(healthCheckQuit)
 		<-chanLimit
-		client.Release()
+		s.wg.Done()
+		if rpcSource != nil {
+			rpcSource.Release()
+		}
 	}()
+	if shutdown.Err() != nil {
+		return
+	}
 	// check whether exist executable task
 	// status = unhandled or
 	// status = underway and now - lastUpdateTime > confTime
-	tasks, err := s.syncIrisModel.GetExecutableTask(maxWorkerSleepTime)
+	tasks, err := s.syncIrisModel.GetExecutableTask(maxWorkerSleepTime, schedulingSort(conf.SvrConf.SchedulingPolicy)...)
 	if err != nil {
 		logger.Error("Get executable task fail", logger.String("err", err.Error()))
 	}
+	if conf.SvrConf.SyncSource != conf.SyncSourceRpc {
+		// follow task can't be executed without rpc node
+		tasks = filterCatchUpTasks(tasks)
+	}
 	if len(tasks) == 0 {
 		// there is no executable tasks
 		return
 	}
 
 	// take over sync task
-	// attempt to update status, worker_id and worker_logs
-	task := tasks[utils.RandInt(len(tasks))]
-	err = s.syncIrisModel.TakeOverTask(task, workerId)
+	// attempt to update status, worker_id, worker_logs, lease and fencing token
+	task, err := s.syncIrisModel.TakeOverTask(pickTask(tasks, conf.SvrConf.SchedulingPolicy), workerId, maxWorkerSleepTime)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			// this task has been take over by other goroutine
@@ -85,28 +135,39 @@ func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTim
 			logger.Error("Take over task fail", logger.String("err", err.Error()))
 		}
 		return
-	} else {
-		// task over task success, update task worker to current worker
-		task.WorkerId = workerId
 	}
+	atomic.AddInt64(&activeTasks, 1)
+	defer atomic.AddInt64(&activeTasks, -1)
+	// lines of task carry task id and worker id
+	log := logger.With(logger.String("taskId", task.ID.Hex()), logger.String("workerId", workerId))
 
+	// catch up task use archive nodes, follow task use nodes near chain tip
+	role := conf.NodeRoleTip
+	taskType = model.SyncTaskTypeFollow
 	if task.EndHeight != 0 {
 		taskType = model.SyncTaskTypeCatchUp
+		role = conf.NodeRoleArchive
+	}
+	if conf.SvrConf.SyncSource != conf.SyncSourceRpc {
+		source = offlineSource
 	} else {
-		taskType = model.SyncTaskTypeFollow
+		rpcSource = block.NewRpcSource(pool.GetClient(role))
+		source = rpcSource
+		if archive != nil {
+			source = block.NewArchivingSource(rpcSource, archive)
+		}
 	}
-	logger.Info("worker begin execute task",
-		logger.String("curWorker", workerId), logger.Any("taskId", task.ID),
+	log.Info("worker begin execute task",
 		logger.String("from-to", fmt.Sprintf("%v-%v", task.StartHeight, task.EndHeight)))
 
-	// worker health check, if worker is alive, then update last update time every minute.
+	// worker health check, if worker is alive, then renew lease three times in a lease.
 	// health check will exit in follow conditions:
 	// 1. task is not owned by current worker
 	// 2. task is invalid
-	workerHealthCheck := func(taskId bson.ObjectId, currentWorker string) {
+	workerHealthCheck := func(owned imodel.SyncTask) {
 		defer func() {
 			if r := recover(); r != nil {
-				logger.Error("worker health check err", logger.Any("err", r))
+				log.Error("worker health check err", logger.Any("err", r))
 			}
 		}()
 
@@ -114,41 +175,84 @@ func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTim
 			for {
 				select {
 				case <-healthCheckQuit:
-					logger.Info("get health check quit signal, now exit health check")
+					log.Info("get health check quit signal, now exit health check")
 					return
 				default:
-					task, err := s.syncIrisModel.GetTaskByIdAndWorker(taskId, workerId)
+					task, err := s.syncIrisModel.GetTaskByIdAndWorker(owned.ID, owned.WorkerId)
 					if err == nil {
 						if _, valid := assertTaskValid(task, blockNumPerWorkerHandle); valid {
-							// update task last update time
-							if err := s.syncIrisModel.UpdateLastUpdateTime(task); err != nil {
-								logger.Error("update last update time fail", logger.String("err", err.Error()))
+							// renew lease of task, it fails if task is owned by other worker
+							if _, err := s.syncIrisModel.RenewLease(owned, maxWorkerSleepTime); err == mgo.ErrNotFound {
+								log.Info("lease of task is lost, exit health check")
+								return
+							} else if err != nil {
+								log.Error("renew lease fail", logger.String("err", err.Error()))
 							}
 						} else {
-							logger.Info("task is invalid, exit health check", logger.String("taskId", taskId.Hex()))
+							log.Info("task is invalid, exit health check")
 							return
 						}
 					} else {
 						if err == mgo.ErrNotFound {
-							logger.Info("task may be task over by other goroutine, exit health check",
-								logger.String("taskId", taskId.Hex()), logger.String("curWorker", workerId))
+							log.Info("task may be task over by other goroutine, exit health check")
 							return
 						} else {
-							logger.Error("get task by id and worker fail", logger.String("taskId", taskId.Hex()),
-								logger.String("curWorker", workerId))
+							log.Error("get task by id and worker fail")
 						}
 					}
 				}
-				time.Sleep(1 * time.Minute)
+				time.Sleep(time.Duration(maxWorkerSleepTime) * time.Second / 3)
 			}
 		}()
 	}
-	go workerHealthCheck(task.ID, workerId)
+	go workerHealthCheck(task)
 
 	// check task is valid
 	// valid catch up task: current_height < end_height
 	// valid follow task: current_height + blockNumPerWorkerHandle > blockChainLatestHeight
 	blockChainLatestHeight, isValid := assertTaskValid(task, blockNumPerWorkerHandle)
+	// handle failure of height, return false if task should be given up.
+	// height which keeps failing or can't be decoded is quarantined and task goes on with next height.
+	// failed attempts of height are recorded in task, so that they are counted across workers taking it over,
+	// retry of the height is delayed with backoff of retry policy
+	handleHeightFail := func(ctx context.Context, height int64, op string, err error) bool {
+		hlog := logger.FromContext(ctx)
+		if shutdown.Err() != nil {
+			// failure caused by shutdown isn't counted, task is released with the height unhandled
+			return true
+		}
+		failedAttempts := task.FailedAttemptsOf(height) + 1
+		var rerr error
+		if task, rerr = s.syncIrisModel.RecordFailure(task, height, failedAttempts); rerr != nil {
+			hlog.Error("record failed attempts of height fail", logger.String("err", rerr.Error()))
+		}
+		// backoff is cut short on shutdown, task is released with the height unhandled
+		if !shouldQuarantine(err, failedAttempts) {
+			if shouldGiveUp(err) {
+				// retry is useless, such as node, dump or archive holding the block isn't added.
+				// task is handed back at once, height is quarantined when its attempts reach the limit
+				hlog.Error("height fail and it isn't retryable, give up task", append([]logger.Field{
+					logger.Int("attempts", failedAttempts)}, utils.ErrFields(err)...)...)
+				if rerr := s.syncIrisModel.ReleaseOwnTask(task); rerr != nil {
+					hlog.Error("release task fail", logger.String("err", rerr.Error()))
+				}
+				return false
+			}
+			retry.Default().Wait(logger.NewContext(shutdown, hlog), op, failedAttempts, err)
+			return true
+		}
+		quarantined, qerr := quarantineHeight(shutdown, task, height, failedAttempts, err)
+		if qerr != nil {
+			hlog.Error("quarantine height fail", logger.String("err", qerr.Error()))
+			retry.Default().Wait(logger.NewContext(shutdown, hlog), op, failedAttempts, err)
+			return true
+		}
+		hlog.Warn("height is quarantined", append([]logger.Field{logger.Int("attempts", failedAttempts)},
+			utils.ErrFields(err)...)...)
+		task = quarantined
+		// failed task of single height is done
+		return task.Status != model.SyncTaskStatusFailed
+	}
 	for isValid {
 		var inProcessBlock int64
 		if task.CurrentHeight == 0 {
@@ -157,34 +261,68 @@ func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTim
 			inProcessBlock = task.CurrentHeight + 1
 		}
 
+		// hand task back with its progress, so that it needn't wait for expire to be taken over
+		if shutdown.Err() != nil {
+			if err := s.syncIrisModel.ReleaseOwnTask(task); err != nil {
+				log.Error("release task on shutdown fail", logger.String("err", err.Error()))
+			} else {
+				log.Info("task is released on shutdown", logger.Int64("currentHeight", task.CurrentHeight))
+			}
+			return
+		}
+
+		// worker holds task while paused, task is kept alive by health check
+		if workersPaused() {
+			sleepCtx(shutdown, controlRefreshInterval)
+			// task may be released or invalidated during pause
+			if unchanged, err := assertTaskWorkerUnchanged(task); err == nil && !unchanged {
+				log.Info("task worker changed during pause, exit")
+				return
+			}
+			continue
+		}
+
 		// if inProcessBlock > blockChainLatestHeight, should wait blockChainLatestHeight update
 		if taskType == model.SyncTaskTypeFollow && inProcessBlock+int64(conf.SvrConf.BehindBlockNum) > blockChainLatestHeight {
-			logger.Info(fmt.Sprintf("wait blockChain latest height update, must interval %v block",
+			log.Info(fmt.Sprintf("wait blockChain latest height update, must interval %v block",
 				conf.SvrConf.BehindBlockNum),
 				logger.Int64("curSyncedHeight", inProcessBlock-1),
 				logger.Int64("blockChainLatestHeight", blockChainLatestHeight))
-			time.Sleep(2 * time.Second)
+			sleepCtx(shutdown, 2*time.Second)
 			// continue to assert task is valid
 			blockChainLatestHeight, isValid = assertTaskValid(task, blockNumPerWorkerHandle)
 			continue
 		}
 
+		// trace fetch, parse and save of current height
+		// retries of fetch and save stop on shutdown
+		ctx, span := tracing.Start(shutdown, "task.executeTask",
+			attribute.Int64("height", inProcessBlock),
+			attribute.String("task_id", task.ID.Hex()),
+			attribute.String("worker_id", workerId),
+			attribute.String("endpoint", source.Name()))
+		// lines emitted with ctx carry height besides task id and worker id
+		hlog := log.With(logger.Int64("height", inProcessBlock))
+		ctx = logger.NewContext(ctx, hlog)
+
 		// parse data from block
-		blockDoc, txDocs, txMsgs, err := block.ParseBlock(inProcessBlock, client)
+		blockDoc, txDocs, txMsgs, err := block.ParseBlock(ctx, inProcessBlock, source)
 		if err != nil {
-			logger.Error("Parse block fail",
-				logger.Int64("height", inProcessBlock),
-				logger.String("errTag", utils.GetErrTag(err)),
-				logger.String("err", err.Error()))
+			span.RecordError(err)
+			span.End()
+			hlog.Error("Parse block fail", utils.ErrFields(err)...)
+			if !handleHeightFail(ctx, inProcessBlock, "task.ParseBlock", err) {
+				return
+			}
 			//continue to assert task is valid
 			blockChainLatestHeight, isValid = assertTaskValid(task, blockNumPerWorkerHandle)
 			continue
 		}
 
 		// check task owner
-		workerUnchanged, err := assertTaskWorkerUnchanged(task.ID, task.WorkerId)
+		workerUnchanged, err := assertTaskWorkerUnchanged(task)
 		if err != nil {
-			logger.Error("assert task worker is unchanged fail", logger.String("err", err.Error()))
+			hlog.Error("assert task worker is unchanged fail", logger.String("err", err.Error()))
 		}
 		if workerUnchanged {
 			// save data and update sync task
@@ -196,31 +334,45 @@ func (s *TaskIrisService) executeTask(blockNumPerWorkerHandle, maxWorkerSleepTim
 				taskDoc.Status = model.SyncTaskStatusCompleted
 			}
 
-			err := block.SaveDocsWithTxn(blockDoc, txDocs, txMsgs, taskDoc)
+			err := block.SaveDocsWithTxn(ctx, blockDoc, txDocs, txMsgs, taskDoc)
+			span.RecordError(err)
+			span.End()
 			if err != nil {
-				if !strings.Contains(err.Error(), utils.ErrDbNotFindTransaction) {
-					logger.Error("save docs fail",
-						logger.Int64("height", inProcessBlock),
-						logger.String("err", err.Error()))
+				if errors.Is(err, txn.ErrAborted) {
+					// fencing token of task is changed, task is owned by other worker
+					hlog.Info("commit is rejected, task is taken over by other worker")
+					return
+				}
+				// docs of conflicted txn may have been saved by other runner, check task later
+				if utils.ErrKindOf(err) != utils.ErrKindTxnConflict {
+					hlog.Error("save docs fail", utils.ErrFields(err)...)
+					if !handleHeightFail(ctx, inProcessBlock, "task.SaveDocs", err) {
+						return
+					}
 					//continue to assert task is valid
 					blockChainLatestHeight, isValid = assertTaskValid(task, blockNumPerWorkerHandle)
 					continue
 				}
 			} else {
 				task.CurrentHeight = inProcessBlock
+				if task.StartHeight == task.EndHeight {
+					// task may be failed task of quarantined height which is retried
+					if err := imodel.DeadLetterModel.Resolve(inProcessBlock); err != nil {
+						hlog.Error("resolve dead letter fail", logger.String("err", err.Error()))
+					}
+				}
 			}
 
 			// continue to assert task is valid
 			blockChainLatestHeight, isValid = assertTaskValid(task, blockNumPerWorkerHandle)
 		} else {
-			logger.Info("task worker changed", logger.Any("task_id", task.ID),
-				logger.String("origin worker", workerId), logger.String("current worker", task.WorkerId))
+			span.End()
+			hlog.Info("task worker changed", logger.String("current worker", task.WorkerId))
 			return
 		}
 	}
 
-	logger.Info("worker finish execute task",
-		logger.String("task_worker", task.WorkerId), logger.Any("task_id", task.ID),
+	log.Info("worker finish execute task",
 		logger.String("from-to-current", fmt.Sprintf("%v-%v-%v", task.StartHeight, task.EndHeight, task.CurrentHeight)))
 }
 
@@ -264,27 +416,43 @@ func assertTaskValid(task imodel.SyncTask, blockNumPerWorkerHandle int64) (int64
 	return blockChainLatestHeight, flag
 }
 
-// assert task worker unchanged
-func assertTaskWorkerUnchanged(taskId bson.ObjectId, workerId string) (bool, error) {
+func filterCatchUpTasks(tasks []imodel.SyncTask) []imodel.SyncTask {
+	ret := make([]imodel.SyncTask, 0, len(tasks))
+	for _, v := range tasks {
+		if v.EndHeight != 0 {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// assert task worker and fencing token unchanged
+func assertTaskWorkerUnchanged(owned imodel.SyncTask) (bool, error) {
 	var (
 		syncTaskModel imodel.SyncTask
 	)
 	// check task owner
-	task, err := syncTaskModel.GetTaskById(taskId)
+	task, err := syncTaskModel.GetTaskById(owned.ID)
 	if err != nil {
 		return false, err
 	}
 
-	if task.WorkerId == workerId {
+	if task.WorkerId == owned.WorkerId && task.FencingToken == owned.FencingToken {
 		return true, nil
 	} else {
 		return false, nil
 	}
 }
 
-// get current block height
+// get current block height from nodes near chain tip,
+// or max height of dump files or archive if sync from them
 func getBlockChainLatestHeight() (int64, error) {
-	client := pool.GetClient()
+	if conf.SvrConf.SyncSource != conf.SyncSourceRpc {
+		height := offlineSource.LatestHeight()
+		atomic.StoreInt64(&seenChainHeight, height)
+		return height, nil
+	}
+	client := pool.GetClient(conf.NodeRoleTip)
 	defer func() {
 		client.Release()
 	}()
@@ -292,6 +460,7 @@ func getBlockChainLatestHeight() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	atomic.StoreInt64(&seenChainHeight, status.SyncInfo.LatestBlockHeight)
 
 	return status.SyncInfo.LatestBlockHeight, nil
 }
@@ -0,0 +1,77 @@
+package task
+
+import (
+	"context"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// instance is taken as stale if its heartbeat is older than staleHeartbeats intervals,
+// it's pruned after pruneHeartbeats intervals so that it's shown in status for a while
+const (
+	heartbeatInterval = 10 * time.Second
+	staleHeartbeats   = 3
+	pruneHeartbeats   = 360
+)
+
+var (
+	// running workers of executing task and tasks owned by them
+	runningWorkers, activeTasks int64
+	// latest height of chain seen by instance
+	seenChainHeight int64
+)
+
+func newInstance(startTime time.Time) imodel.Instance {
+	hostname, _ := os.Hostname()
+	return imodel.Instance{
+		ID:            InstanceId,
+		Hostname:      hostname,
+		Pid:           os.Getpid(),
+		Version:       conf.Version,
+		ConfHash:      conf.SvrConf.Hash(),
+		StartTime:     startTime.Unix(),
+		HeartbeatTime: time.Now().Unix(),
+		Workers:       int(atomic.LoadInt64(&runningWorkers)),
+		MaxWorkers:    conf.SvrConf.WorkerNumExecuteTask,
+		ActiveTasks:   int(atomic.LoadInt64(&activeTasks)),
+		PlannerLeader: isPlannerLeader(),
+		ChainHeight:   atomic.LoadInt64(&seenChainHeight),
+	}
+}
+
+// register instance and update its heartbeat until ctx is done, instance is removed then
+func keepInstanceAlive(ctx context.Context) {
+	startTime := time.Now()
+	for {
+		if err := imodel.InstanceModel.Heartbeat(newInstance(startTime)); err != nil {
+			logger.Error("update heartbeat of instance fail", logger.String("err", err.Error()))
+		}
+		pruneInstances(time.Now())
+		select {
+		case <-ctx.Done():
+			if err := imodel.InstanceModel.Remove(InstanceId); err != nil {
+				logger.Error("remove instance fail", logger.String("err", err.Error()))
+			}
+			return
+		case <-time.After(heartbeatInterval):
+		}
+	}
+}
+
+// remove instances which are killed without removing themselves, every instance prunes them
+// and removing is idempotent
+func pruneInstances(now time.Time) {
+	before := now.Add(-pruneHeartbeats * heartbeatInterval).Unix()
+	removed, err := imodel.InstanceModel.RemoveStale(before)
+	if err != nil {
+		logger.Error("prune stale instances fail", logger.String("err", err.Error()))
+		return
+	}
+	if removed > 0 {
+		logger.Info("prune stale instances", logger.Int("removed", removed))
+	}
+}
@@ -0,0 +1,105 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/monitor/metrics"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// id of current instance, hostname@xxx
+	InstanceId = genInstanceId()
+
+	plannerLeader struct {
+		sync.Mutex
+		leader       bool
+		fencingToken int64
+		expireAt     time.Time
+	}
+
+	plannerLeaderGauge, _ = metrics.CovertGuage(metrics.NewGuage(
+		"sync",
+		"planner",
+		"leader",
+		"whether instance is leader which plans tasks, 1 is leader",
+		[]string{"instance"},
+	))
+)
+
+func genInstanceId() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%v@%v", hostname, bson.NewObjectId().Hex())
+}
+
+// whether current instance holds lease of planner, lease which isn't renewed in time is taken as lost
+func isPlannerLeader() bool {
+	plannerLeader.Lock()
+	defer plannerLeader.Unlock()
+	return plannerLeader.leader && time.Now().Before(plannerLeader.expireAt)
+}
+
+// fencing token of lease held by current instance, false is returned if instance isn't leader
+func plannerFencingToken() (int64, bool) {
+	plannerLeader.Lock()
+	defer plannerLeader.Unlock()
+	if !plannerLeader.leader || !time.Now().Before(plannerLeader.expireAt) {
+		return 0, false
+	}
+	return plannerLeader.fencingToken, true
+}
+
+// acquire or renew lease of planner, leadership is kept until lease expires if db fails
+func renewPlannerLease() {
+	leaseDuration := int64(conf.SvrConf.PlannerLeaseSeconds)
+	start := time.Now()
+	lease, acquired, err := imodel.PlannerLeaseModel.Acquire(InstanceId, leaseDuration)
+	if err != nil {
+		logger.Error("acquire planner lease fail", logger.String("err", err.Error()))
+		return
+	}
+	setPlannerLeader(acquired, lease.FencingToken, start.Add(time.Duration(leaseDuration)*time.Second))
+}
+
+func setPlannerLeader(leader bool, fencingToken int64, expireAt time.Time) {
+	plannerLeader.Lock()
+	defer plannerLeader.Unlock()
+	if leader != plannerLeader.leader {
+		if leader {
+			logger.Info("instance becomes leader of planner", logger.String("instance", InstanceId))
+		} else {
+			logger.Info("instance isn't leader of planner any more", logger.String("instance", InstanceId))
+		}
+	}
+	plannerLeader.leader, plannerLeader.fencingToken, plannerLeader.expireAt = leader, fencingToken, expireAt
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	plannerLeaderGauge.With("instance", InstanceId).Set(value)
+}
+
+// renew lease of planner three times in a lease until ctx is done, lease is released then
+func keepPlannerLease(ctx context.Context) {
+	interval := time.Duration(conf.SvrConf.PlannerLeaseSeconds) * time.Second / 3
+	for {
+		select {
+		case <-ctx.Done():
+			if isPlannerLeader() {
+				if err := imodel.PlannerLeaseModel.Release(InstanceId); err != nil {
+					logger.Error("release planner lease fail", logger.String("err", err.Error()))
+				}
+				setPlannerLeader(false, 0, time.Time{})
+			}
+			return
+		case <-time.After(interval):
+			renewPlannerLease()
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package task
+
+import (
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestIsPlannerLeader(t *testing.T) {
+	defer setPlannerLeader(false, 0, time.Time{})
+
+	setPlannerLeader(true, 3, time.Now().Add(time.Minute))
+	if token, ok := plannerFencingToken(); !isPlannerLeader() || !ok || token != 3 {
+		t.Error("instance should be leader with fencing token before lease expires")
+	}
+	setPlannerLeader(true, 3, time.Now().Add(-time.Second))
+	if _, ok := plannerFencingToken(); isPlannerLeader() || ok {
+		t.Error("lease which isn't renewed in time should be taken as lost")
+	}
+	setPlannerLeader(false, 3, time.Now().Add(time.Minute))
+	if _, ok := plannerFencingToken(); isPlannerLeader() || ok {
+		t.Error("instance shouldn't be leader when lease is held by other instance")
+	}
+}
+
+func TestPlannerFenceOp(t *testing.T) {
+	op := imodel.PlannerLeaseModel.FenceOp("a@1", 7)
+	assert, ok := op.Assert.(bson.M)
+	if !ok || op.C != imodel.CollectionNameControl || op.Insert != nil || op.Update != nil || op.Remove {
+		t.Fatalf("fence op should only assert lease, got %+v", op)
+	}
+	if assert["instance_id"] != "a@1" || assert["fencing_token"] != int64(7) {
+		t.Errorf("fence op should assert instance and fencing token, got %v", assert)
+	}
+}
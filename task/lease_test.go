@@ -0,0 +1,76 @@
+package task
+
+import (
+	"github.com/irisnet/rainbow-sync/db"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"testing"
+)
+
+func TestSyncTask_LeaseExpired(t *testing.T) {
+	cases := []struct {
+		name    string
+		task    imodel.SyncTask
+		expired bool
+	}{
+		{"lease not expired", imodel.SyncTask{LeaseExpireTime: 101, LastUpdateTime: 0}, false},
+		{"lease expires at now", imodel.SyncTask{LeaseExpireTime: 100, LastUpdateTime: 99}, true},
+		{"lease expired", imodel.SyncTask{LeaseExpireTime: 90, LastUpdateTime: 99}, true},
+		{"no lease, updated recently", imodel.SyncTask{LastUpdateTime: 50}, false},
+		{"no lease, not updated in time", imodel.SyncTask{LastUpdateTime: 39}, true},
+	}
+	for _, c := range cases {
+		if got := c.task.LeaseExpired(100, 60); got != c.expired {
+			t.Errorf("%v: expired should be %v, got %v", c.name, c.expired, got)
+		}
+	}
+}
+
+func TestSyncTask_TakeOverSelector(t *testing.T) {
+	task := imodel.SyncTask{ID: bson.NewObjectId(), LastUpdateTime: 10, FencingToken: 3}
+	want := bson.M{"_id": task.ID, "last_update_time": int64(10), "fencing_token": int64(3)}
+	if got := task.TakeOverSelector(task); !reflect.DeepEqual(got, want) {
+		t.Errorf("take over selector should match read fencing token, got %v", got)
+	}
+
+	// task written before leases has no fencing token
+	task.FencingToken = 0
+	want["fencing_token"] = bson.M{"$in": []interface{}{0, nil}}
+	if got := task.TakeOverSelector(task); !reflect.DeepEqual(got, want) {
+		t.Errorf("take over selector should match missing fencing token, got %v", got)
+	}
+}
+
+func TestSyncTask_OwnerSelector(t *testing.T) {
+	task := imodel.SyncTask{ID: bson.NewObjectId(), WorkerId: "w1", FencingToken: 4, LastUpdateTime: 10}
+	want := bson.M{"_id": task.ID, "worker_id": "w1", "fencing_token": int64(4)}
+	if got := task.OwnerSelector(task); !reflect.DeepEqual(got, want) {
+		t.Errorf("owner selector should match worker and fencing token only, got %v", got)
+	}
+}
+
+func TestSyncTask_CommitOp(t *testing.T) {
+	task := imodel.SyncTask{
+		ID:             bson.NewObjectId(),
+		WorkerId:       "w1",
+		FencingToken:   5,
+		CurrentHeight:  120,
+		Status:         db.SyncTaskStatusUnderway,
+		LastUpdateTime: 10,
+	}
+	op := task.CommitOp(task)
+	if op.C != imodel.CollectionNameSyncTask || op.Id != task.ID || op.Insert != nil || op.Remove {
+		t.Fatalf("commit op should update task, got %+v", op)
+	}
+	if want := (bson.M{"worker_id": "w1", "fencing_token": int64(5)}); !reflect.DeepEqual(op.Assert, want) {
+		t.Errorf("commit op should assert worker and fencing token, got %v", op.Assert)
+	}
+	set := op.Update.(bson.M)["$set"].(bson.M)
+	if set["current_height"] != int64(120) || set["status"] != db.SyncTaskStatusUnderway {
+		t.Errorf("commit op should set progress of task, got %v", set)
+	}
+	if _, ok := set["fencing_token"]; ok {
+		t.Error("commit op shouldn't change fencing token")
+	}
+}
@@ -0,0 +1,200 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"github.com/irisnet/rainbow-sync/conf"
+	model "github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/utils"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
+	"time"
+)
+
+func quarantineEnabled() bool {
+	return conf.SvrConf.QuarantineMaxFailures > 0
+}
+
+// whether height failed attempts times with err should be quarantined,
+// height which can't be decoded is quarantined at once
+func shouldQuarantine(err error, attempts int) bool {
+	if !quarantineEnabled() {
+		return false
+	}
+	return utils.ErrKindOf(err) == utils.ErrKindDecode || attempts >= conf.SvrConf.QuarantineMaxFailures
+}
+
+// whether task should be given up on height failed with err which isn't quarantined.
+// task is never given up when quarantine is disabled, or it would be taken over and fail
+// at the height again at once, height is retried with backoff instead
+func shouldGiveUp(err error) bool {
+	return quarantineEnabled() && !utils.IsRetryable(err)
+}
+
+// quarantine height of task, the height is recorded in dead letter and moved to a failed task of single height,
+// task goes on with next height. if task is single height task of the height, task itself is set failed.
+// task with updated current height and status is returned
+func quarantineHeight(ctx context.Context, task imodel.SyncTask, height int64, attempts int, err error) (imodel.SyncTask, error) {
+	var (
+		ops []txn.Op
+		now = time.Now().Unix()
+	)
+	failedTaskId := task.ID
+	if task.StartHeight == height && task.EndHeight == height {
+		task.Status = model.SyncTaskStatusFailed
+		ops = append(ops, txn.Op{
+			C:      imodel.CollectionNameSyncTask,
+			Id:     task.ID,
+			Assert: bson.M{"worker_id": task.WorkerId, "fencing_token": task.FencingToken},
+			Update: bson.M{
+				"$set": bson.M{
+					"status":           task.Status,
+					"last_update_time": now,
+					// retried height counts attempts again
+					"failed_attempts": 0,
+				},
+			},
+		})
+	} else {
+		failedTaskId = bson.NewObjectId()
+		ops = append(ops, txn.Op{
+			C:  imodel.CollectionNameSyncTask,
+			Id: failedTaskId,
+			Insert: imodel.SyncTask{
+				ID:             failedTaskId,
+				StartHeight:    height,
+				EndHeight:      height,
+				Status:         model.SyncTaskStatusFailed,
+				LastUpdateTime: now,
+			},
+		})
+
+		currentHeight := task.CurrentHeight
+		task.CurrentHeight = height
+		if height == task.EndHeight {
+			task.Status = model.SyncTaskStatusCompleted
+		}
+		ops = append(ops, txn.Op{
+			C:  imodel.CollectionNameSyncTask,
+			Id: task.ID,
+			Assert: bson.M{
+				"worker_id":      task.WorkerId,
+				"fencing_token":  task.FencingToken,
+				"current_height": currentHeight,
+			},
+			Update: bson.M{
+				"$set": bson.M{
+					"current_height":   task.CurrentHeight,
+					"status":           task.Status,
+					"last_update_time": now,
+					"failed_attempts":  0,
+				},
+			},
+		})
+	}
+
+	op, qerr := buildDeadLetterOp(height, failedTaskId, attempts, err, now)
+	if qerr != nil {
+		return task, qerr
+	}
+	if err := model.Txn(ctx, append(ops, op)); err != nil {
+		return task, err
+	}
+	task.LastUpdateTime, task.FailedAttempts = now, 0
+	return task, nil
+}
+
+// insert dead letter of height, or update it if height has been quarantined before
+func buildDeadLetterOp(height int64, taskId bson.ObjectId, attempts int, err error, now int64) (txn.Op, error) {
+	var se *utils.SyncError
+	errStage := ""
+	if errors.As(err, &se) {
+		errStage = se.Stage
+	}
+	deadLetter, qerr := imodel.DeadLetterModel.GetByHeight(height)
+	if qerr != nil && qerr != mgo.ErrNotFound {
+		return txn.Op{}, qerr
+	}
+	if qerr == mgo.ErrNotFound {
+		id := bson.NewObjectId()
+		return txn.Op{
+			C:  imodel.CollectionNameDeadLetter,
+			Id: id,
+			Insert: imodel.DeadLetter{
+				ID:          id,
+				Height:      height,
+				TaskId:      taskId,
+				ErrKind:     string(utils.ErrKindOf(err)),
+				ErrStage:    errStage,
+				Error:       err.Error(),
+				Attempts:    attempts,
+				Quarantines: 1,
+				Status:      imodel.DeadLetterStatusQuarantined,
+				CreateTime:  now,
+				UpdateTime:  now,
+			},
+		}, nil
+	}
+	return txn.Op{
+		C:      imodel.CollectionNameDeadLetter,
+		Id:     deadLetter.ID,
+		Assert: bson.M{"status": bson.M{"$ne": imodel.DeadLetterStatusQuarantined}},
+		Update: bson.M{
+			"$set": bson.M{
+				"task_id":     taskId,
+				"err_kind":    string(utils.ErrKindOf(err)),
+				"err_stage":   errStage,
+				"error":       err.Error(),
+				"status":      imodel.DeadLetterStatusQuarantined,
+				"update_time": now,
+			},
+			"$inc": bson.M{"attempts": attempts, "quarantines": 1},
+		},
+	}, nil
+}
+
+// set failed tasks of quarantined heights unhandled so that they are synced again, all quarantined heights
+// are retried if heights is empty. num of retried heights is returned
+func RetryQuarantined(heights []int64) (int, error) {
+	deadLetters, err := imodel.DeadLetterModel.QueryByStatus(imodel.DeadLetterStatusQuarantined, heights)
+	if err != nil {
+		return 0, err
+	}
+	var retried int
+	for _, v := range deadLetters {
+		now := time.Now().Unix()
+		ops := []txn.Op{
+			{
+				C:      imodel.CollectionNameSyncTask,
+				Id:     v.TaskId,
+				Assert: bson.M{"status": model.SyncTaskStatusFailed},
+				Update: bson.M{
+					"$set": bson.M{
+						"status":           model.SyncTaskStatusUnHandled,
+						"current_height":   0,
+						"worker_id":        "",
+						"last_update_time": now,
+					},
+				},
+			},
+			{
+				C:      imodel.CollectionNameDeadLetter,
+				Id:     v.ID,
+				Assert: bson.M{"status": imodel.DeadLetterStatusQuarantined},
+				Update: bson.M{"$set": bson.M{"status": imodel.DeadLetterStatusRetrying, "update_time": now}},
+			},
+		}
+		if err := model.Txn(context.Background(), ops); err != nil {
+			logger.Error("retry quarantined height fail", logger.Int64("height", v.Height),
+				logger.String("err", err.Error()))
+			continue
+		}
+		logger.Info("quarantined height is set to retry", logger.Int64("height", v.Height),
+			logger.Any("taskId", v.TaskId))
+		retried++
+	}
+	return retried, nil
+}
@@ -0,0 +1,62 @@
+package task
+
+import (
+	"errors"
+	"github.com/irisnet/rainbow-sync/conf"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/utils"
+	"testing"
+)
+
+func TestShouldQuarantine(t *testing.T) {
+	defer func(n int) { conf.SvrConf.QuarantineMaxFailures = n }(conf.SvrConf.QuarantineMaxFailures)
+	conf.SvrConf.QuarantineMaxFailures = 3
+
+	rpcErr := utils.WrapErr(utils.ErrKindRpc, "rpc.Block", errors.New("timeout"))
+	decodeErr := utils.WrapErr(utils.ErrKindDecode, "ParseBlock", errors.New("recovered panic"))
+	if shouldQuarantine(rpcErr, 2) || !shouldQuarantine(rpcErr, 3) {
+		t.Error("height should be quarantined after 3 failures")
+	}
+	if !shouldQuarantine(decodeErr, 1) {
+		t.Error("height which can't be decoded should be quarantined at once")
+	}
+
+	conf.SvrConf.QuarantineMaxFailures = 0
+	if shouldQuarantine(decodeErr, 100) {
+		t.Error("height shouldn't be quarantined when it's disabled")
+	}
+}
+
+func TestShouldGiveUp(t *testing.T) {
+	defer func(n int) { conf.SvrConf.QuarantineMaxFailures = n }(conf.SvrConf.QuarantineMaxFailures)
+	conf.SvrConf.QuarantineMaxFailures = 3
+
+	rpcErr := utils.WrapErr(utils.ErrKindRpc, "rpc.Block", errors.New("timeout"))
+	unavailableErr := utils.WrapErr(utils.ErrKindUnavailable, "dump.Load", errors.New("height not found"))
+	decodeErr := utils.WrapErr(utils.ErrKindDecode, "ParseBlock", errors.New("recovered panic"))
+	if shouldGiveUp(rpcErr) || !shouldGiveUp(unavailableErr) {
+		t.Error("only task failed with error which isn't retryable should be given up")
+	}
+
+	// task is retried with backoff instead of being given up and taken over in a loop
+	conf.SvrConf.QuarantineMaxFailures = 0
+	if shouldGiveUp(unavailableErr) || shouldGiveUp(decodeErr) {
+		t.Error("task shouldn't be given up when quarantine is disabled")
+	}
+}
+
+func TestFailedAttemptsAcrossTakeover(t *testing.T) {
+	defer func(n int) { conf.SvrConf.QuarantineMaxFailures = n }(conf.SvrConf.QuarantineMaxFailures)
+	conf.SvrConf.QuarantineMaxFailures = 3
+
+	unavailableErr := utils.WrapErr(utils.ErrKindUnavailable, "dump.Load", errors.New("height not found"))
+	// worker taking over task goes on counting attempts of height recorded by previous workers
+	task := imodel.SyncTask{StartHeight: 101, EndHeight: 200, CurrentHeight: 120, FailedHeight: 121, FailedAttempts: 2}
+	attempts := task.FailedAttemptsOf(121) + 1
+	if !shouldQuarantine(unavailableErr, attempts) {
+		t.Errorf("height should be quarantined at limit whatever kind of error is, attempts %v", attempts)
+	}
+	if task.FailedAttemptsOf(122) != 0 {
+		t.Error("attempts of other height shouldn't be counted")
+	}
+}
@@ -0,0 +1,61 @@
+package task
+
+import (
+	"github.com/irisnet/rainbow-sync/conf"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"github.com/irisnet/rainbow-sync/utils"
+)
+
+// sort fields of catch up tasks which are candidates of policy
+func schedulingSort(policy string) []string {
+	switch policy {
+	case conf.SchedulingPolicyOldest:
+		return []string{"start_height"}
+	case conf.SchedulingPolicyNewest:
+		return []string{"-start_height"}
+	case conf.SchedulingPolicyPriority:
+		return []string{"-priority", "start_height"}
+	default:
+		// expired underway tasks first
+		return []string{"-status"}
+	}
+}
+
+// choose task to execute from candidates sorted by schedulingSort, follow task is chosen first.
+// worker which fails to take over chosen task tries again when next worker is started
+func pickTask(tasks []imodel.SyncTask, policy string) imodel.SyncTask {
+	for _, v := range tasks {
+		if v.EndHeight == 0 {
+			return v
+		}
+	}
+	switch policy {
+	case conf.SchedulingPolicyOldest, conf.SchedulingPolicyNewest:
+		return tasks[0]
+	case conf.SchedulingPolicyPriority:
+		return tasks[pickWeighted(tasks, utils.RandInt)]
+	default:
+		return tasks[utils.RandInt(len(tasks))]
+	}
+}
+
+// pick index of task randomly with weight of priority+1, negative priority is taken as 0
+func pickWeighted(tasks []imodel.SyncTask, randInt func(n int) int) int {
+	weight := func(t imodel.SyncTask) int {
+		if t.Priority < 0 {
+			return 1
+		}
+		return t.Priority + 1
+	}
+	var total int
+	for _, v := range tasks {
+		total += weight(v)
+	}
+	n := randInt(total)
+	for i, v := range tasks {
+		if n -= weight(v); n < 0 {
+			return i
+		}
+	}
+	return len(tasks) - 1
+}
@@ -0,0 +1,36 @@
+package task
+
+import (
+	"github.com/irisnet/rainbow-sync/conf"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"testing"
+)
+
+func TestPickTask(t *testing.T) {
+	catchUp := []imodel.SyncTask{{StartHeight: 101, EndHeight: 200}, {StartHeight: 1, EndHeight: 100}}
+	withFollow := append(catchUp, imodel.SyncTask{StartHeight: 201})
+	for _, policy := range []string{conf.SchedulingPolicyOldest, conf.SchedulingPolicyNewest,
+		conf.SchedulingPolicyRandom, conf.SchedulingPolicyPriority} {
+		if got := pickTask(withFollow, policy); got.EndHeight != 0 {
+			t.Errorf("follow task should be picked first by %v policy, got %v", policy, got.StartHeight)
+		}
+	}
+	if got := pickTask(catchUp, conf.SchedulingPolicyNewest); got.StartHeight != 101 {
+		t.Errorf("first candidate should be picked, got %v", got.StartHeight)
+	}
+}
+
+func TestPickWeighted(t *testing.T) {
+	tasks := []imodel.SyncTask{{Priority: 0}, {Priority: 2}, {Priority: -1}}
+	// weights are 1, 3 and 1
+	for n, want := range []int{0, 1, 1, 1, 2} {
+		if got := pickWeighted(tasks, func(total int) int {
+			if total != 5 {
+				t.Fatalf("total weight should be 5, got %v", total)
+			}
+			return n
+		}); got != want {
+			t.Errorf("pick %v should be task %v, got %v", n, want, got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package task
+
+import (
+	"context"
+	"github.com/irisnet/rainbow-sync/conf"
+	model "github.com/irisnet/rainbow-sync/db"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"sort"
+	"time"
+)
+
+// synced blocks within the range of height are sampled to estimate density of blocks around height,
+// so that task is sized by blocks near its own heights rather than latest blocks
+const densitySampleRange = 1000
+
+// num of blocks of catch up task after height, task holds about TaskTargetTxNum txs
+// estimated by density of synced blocks around height
+func catchUpTaskSize(height int64) int64 {
+	if conf.SvrConf.TaskTargetTxNum == 0 {
+		return int64(conf.SvrConf.BlockNumPerWorkerHandle)
+	}
+	avgTxNum, sampled, err := imodel.BlockModel.AvgTxNum(height-densitySampleRange+1, height+densitySampleRange)
+	if err != nil {
+		logger.Warn("estimate tx num of blocks fail", logger.String("err", err.Error()))
+		return int64(conf.SvrConf.BlockNumPerWorkerHandle)
+	}
+	return taskSizeOf(avgTxNum, sampled)
+}
+
+// num of blocks holding TaskTargetTxNum txs in bounds of task size,
+// BlockNumPerWorkerHandle is used when no block is sampled
+func taskSizeOf(avgTxNum float64, sampled int) int64 {
+	var (
+		minSize = int64(conf.SvrConf.TaskMinBlockNum)
+		maxSize = int64(conf.SvrConf.TaskMaxBlockNum)
+		size    = int64(conf.SvrConf.BlockNumPerWorkerHandle)
+	)
+	if sampled > 0 {
+		size = maxSize
+		if avgTxNum > 0 {
+			if n := float64(conf.SvrConf.TaskTargetTxNum) / avgTxNum; n < float64(maxSize) {
+				size = int64(n)
+			}
+		}
+	}
+	if size < minSize {
+		return minSize
+	}
+	if size > maxSize {
+		return maxSize
+	}
+	return size
+}
+
+// split unhandled catch up tasks which are much larger than size of new task when workers are idle,
+// that's num of unhandled tasks is less than num of idle workers of cluster. largest tasks are split first
+func (s *TaskIrisService) splitOversizedTasks(ctx context.Context) {
+	if conf.SvrConf.TaskTargetTxNum == 0 {
+		return
+	}
+	tasks, err := s.syncIrisModel.QueryAll([]string{model.SyncTaskStatusUnHandled}, model.SyncTaskTypeCatchUp)
+	if err != nil {
+		logger.Error("query unhandled catch up tasks fail", logger.String("err", err.Error()))
+		return
+	}
+	idle := clusterIdleWorkers() - len(tasks)
+	if idle <= 0 {
+		return
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return remainingBlockNum(tasks[i]) > remainingBlockNum(tasks[j])
+	})
+	for _, task := range tasks {
+		if idle == 0 {
+			break
+		}
+		splitHeight, ok := oversizedSplitHeight(task, catchUpTaskSize(syncedHeight(task)))
+		if !ok {
+			// rest tasks are smaller
+			break
+		}
+		newTask, err := s.syncIrisModel.SplitTask(ctx, task, splitHeight)
+		if err != nil {
+			// task may be taken over since it's read
+			logger.Warn("split oversized task fail", logger.String("taskId", task.ID.Hex()),
+				logger.String("err", err.Error()))
+			continue
+		}
+		logger.Info("oversized task is split for idle workers", logger.String("taskId", task.ID.Hex()),
+			logger.String("newTaskId", newTask.ID.Hex()), logger.Int64("height", splitHeight))
+		idle--
+	}
+}
+
+// num of workers which don't own task in alive instances, they are counted by heartbeats
+// so that it may lag behind by a heartbeat interval. if instances can't be queried,
+// all workers of this instance are taken as idle like a single instance
+func clusterIdleWorkers() int {
+	instances, err := imodel.InstanceModel.QueryAll()
+	if err != nil {
+		logger.Warn("query instances fail, count idle workers of this instance",
+			logger.String("err", err.Error()))
+		return conf.SvrConf.WorkerNumExecuteTask
+	}
+	return idleWorkersOf(instances, time.Now())
+}
+
+// idle workers of instances which aren't stale, instance registered before max workers
+// is reported has no idle worker
+func idleWorkersOf(instances []imodel.Instance, now time.Time) int {
+	var idle int
+	for _, v := range instances {
+		if instanceStale(v, now) || v.MaxWorkers <= v.ActiveTasks {
+			continue
+		}
+		idle += v.MaxWorkers - v.ActiveTasks
+	}
+	return idle
+}
+
+// num of blocks which haven't been synced of task
+func remainingBlockNum(task imodel.SyncTask) int64 {
+	if task.CurrentHeight >= task.StartHeight {
+		return task.EndHeight - task.CurrentHeight
+	}
+	return task.EndHeight - task.StartHeight + 1
+}
+
+// height where task with more than twice of size remaining blocks is split,
+// task keeps size blocks after its progress
+func oversizedSplitHeight(task imodel.SyncTask, size int64) (int64, bool) {
+	if remainingBlockNum(task) <= 2*size {
+		return 0, false
+	}
+	return syncedHeight(task) + size, true
+}
+
+// height which task has synced to, it's the height before start height if task hasn't made progress
+func syncedHeight(task imodel.SyncTask) int64 {
+	if task.CurrentHeight >= task.StartHeight {
+		return task.CurrentHeight
+	}
+	return task.StartHeight - 1
+}
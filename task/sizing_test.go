@@ -0,0 +1,84 @@
+package task
+
+import (
+	"github.com/irisnet/rainbow-sync/conf"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"testing"
+	"time"
+)
+
+func TestTaskSizeOf(t *testing.T) {
+	defer func(c conf.ServerConf) { *conf.SvrConf = c }(*conf.SvrConf)
+	conf.SvrConf.BlockNumPerWorkerHandle = 50
+	conf.SvrConf.TaskTargetTxNum = 2000
+	conf.SvrConf.TaskMinBlockNum = 10
+	conf.SvrConf.TaskMaxBlockNum = 1000
+
+	for _, c := range []struct {
+		avgTxNum float64
+		sampled  int
+		want     int64
+	}{
+		{0, 0, 50},     // density is unknown
+		{0, 100, 1000}, // empty blocks
+		{0.5, 100, 1000},
+		{8, 100, 250},
+		{1000, 100, 10},
+	} {
+		if got := taskSizeOf(c.avgTxNum, c.sampled); got != c.want {
+			t.Errorf("size of avg tx num %v should be %v, got %v", c.avgTxNum, c.want, got)
+		}
+	}
+}
+
+func TestOversizedSplitHeight(t *testing.T) {
+	task := imodel.SyncTask{StartHeight: 1, EndHeight: 1000}
+	if h, ok := oversizedSplitHeight(task, 100); !ok || h != 100 {
+		t.Errorf("task should be split at 100, got %v %v", h, ok)
+	}
+	task.CurrentHeight = 850
+	if h, ok := oversizedSplitHeight(task, 100); ok {
+		t.Errorf("task with 150 remaining blocks shouldn't be split, got %v", h)
+	}
+	if h, ok := oversizedSplitHeight(task, 50); !ok || h != 900 {
+		t.Errorf("task should be split at 900, got %v %v", h, ok)
+	}
+}
+
+func TestCreateCatchUpTask(t *testing.T) {
+	size := func(int64) int64 { return 100 }
+	tasks := createCatchUpTask(0, 50, 260, size)
+	if len(tasks) != 3 || tasks[1].StartHeight != 101 || tasks[1].EndHeight != 200 || tasks[2].EndHeight != 260 {
+		t.Fatalf("unexpected tasks %v", tasks)
+	}
+	// rest blocks less than 50 are left to follow task
+	if tasks := createCatchUpTask(0, 50, 230, size); len(tasks) != 2 || tasks[1].EndHeight != 200 {
+		t.Errorf("tasks should end at 200, got %v tasks", len(tasks))
+	}
+	// each task is sized by density around its own heights
+	sizeAt := func(height int64) int64 {
+		if height >= 100 {
+			return 20
+		}
+		return 100
+	}
+	if tasks := createCatchUpTask(0, 10, 150, sizeAt); len(tasks) != 4 || tasks[1].StartHeight != 101 ||
+		tasks[1].EndHeight != 120 || tasks[3].EndHeight != 150 {
+		t.Errorf("tasks should be sized by their heights, got %v", tasks)
+	}
+}
+
+func TestIdleWorkersOf(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	instances := []imodel.Instance{
+		{ID: "a@1", HeartbeatTime: now.Unix() - 5, MaxWorkers: 10, ActiveTasks: 4},
+		{ID: "b@2", HeartbeatTime: now.Unix(), MaxWorkers: 5, ActiveTasks: 5},
+		// stale instance
+		{ID: "c@3", HeartbeatTime: now.Unix() - 60, MaxWorkers: 10},
+		// registered before max workers is reported
+		{ID: "d@4", HeartbeatTime: now.Unix(), ActiveTasks: 2},
+	}
+	if idle := idleWorkersOf(instances, now); idle != 6 {
+		t.Errorf("idle workers should be counted from alive instances, got %v", idle)
+	}
+}
@@ -1,10 +1,81 @@
 package task
 
-import "github.com/irisnet/rainbow-sync/monitor"
+import (
+	"context"
+	"github.com/irisnet/rainbow-sync/block"
+	"github.com/irisnet/rainbow-sync/conf"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"github.com/irisnet/rainbow-sync/monitor"
+	"sync"
+)
 
-func Start() {
+var (
+	// source of blocks when sync from dump files or archive
+	offlineSource block.OfflineSource
+	// archive of blocks read from rpc nodes, nil if archive is disabled
+	archive *block.Archive
+)
+
+// start creating and executing tasks until ctx is done,
+// returned channel is closed when running workers have released their tasks
+func Start(ctx context.Context) <-chan struct{} {
+	switch conf.SvrConf.SyncSource {
+	case conf.SyncSourceDump:
+		dumpSource, err := block.NewDumpSource(conf.SvrConf.DumpDir)
+		if err != nil {
+			logger.Fatal("open dump dir fail", logger.String("dir", conf.SvrConf.DumpDir),
+				logger.String("err", err.Error()))
+		}
+		offlineSource = dumpSource
+		logger.Info("sync from dump files", logger.String("dir", conf.SvrConf.DumpDir),
+			logger.Int64("latestHeight", dumpSource.LatestHeight()))
+	case conf.SyncSourceArchive:
+		offlineSource = block.NewArchiveSource(openArchive())
+		logger.Info("sync from archive", logger.String("dir", conf.SvrConf.ArchiveDir),
+			logger.Int64("latestHeight", offlineSource.LatestHeight()))
+	default:
+		if conf.SvrConf.ArchiveDir != "" {
+			archive = openArchive()
+			logger.Info("archive blocks read from rpc nodes", logger.String("dir", conf.SvrConf.ArchiveDir))
+		}
+	}
 	synctask := new(TaskIrisService)
-	go synctask.StartCreateTask()
-	go synctask.StartExecuteTask()
-	go monitor.Start()
+	// goroutines are added to wg only by spawn loops and before them
+	var loops sync.WaitGroup
+	loops.Add(2)
+	go func() {
+		defer loops.Done()
+		synctask.StartCreateTask(ctx)
+	}()
+	go func() {
+		defer loops.Done()
+		synctask.StartExecuteTask(ctx)
+	}()
+	go monitor.Start(ctx)
+	synctask.wg.Add(1)
+	go func() {
+		defer synctask.wg.Done()
+		keepInstanceAlive(ctx)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		// spawn loops return after ctx is done, no goroutine is added to wg then
+		loops.Wait()
+		synctask.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func openArchive() *block.Archive {
+	if conf.SvrConf.ArchiveDir == "" {
+		logger.Fatal("archive dir is required", logger.String("env", conf.EnvNameArchiveDir))
+	}
+	a, err := block.NewArchive(conf.SvrConf.ArchiveDir, conf.SvrConf.ArchiveRangeSize)
+	if err != nil {
+		logger.Fatal("open archive dir fail", logger.String("dir", conf.SvrConf.ArchiveDir),
+			logger.String("err", err.Error()))
+	}
+	return a
 }
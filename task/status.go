@@ -0,0 +1,105 @@
+package task
+
+import (
+	"fmt"
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"gopkg.in/mgo.v2"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// ClusterStatus is progress of sync and activity of registered instances
+type ClusterStatus struct {
+	TaskCounts    map[string]int
+	CatchUpTotal  int64 // heights of catch up tasks
+	CatchUpSynced int64
+	SyncedHeight  int64 // max height of synced blocks
+	ChainHeight   int64 // max latest height of chain seen by alive instances
+	PlannerLease  imodel.PlannerLease
+	Instances     []imodel.Instance
+	Now           time.Time
+}
+
+// read status of cluster from db
+func GetClusterStatus() (ClusterStatus, error) {
+	status := ClusterStatus{Now: time.Now()}
+	var err error
+	if status.TaskCounts, err = imodel.SyncTaskModel.CountByStatus(); err != nil {
+		return status, err
+	}
+	if status.CatchUpTotal, status.CatchUpSynced, err = imodel.SyncTaskModel.CatchUpProgress(); err != nil {
+		return status, err
+	}
+	block, err := imodel.BlockModel.GetMaxBlockHeight()
+	if err != nil && err != mgo.ErrNotFound {
+		return status, err
+	}
+	status.SyncedHeight = block.Height
+	if status.PlannerLease, err = imodel.PlannerLeaseModel.Get(); err != nil {
+		return status, err
+	}
+	if status.Instances, err = imodel.InstanceModel.QueryAll(); err != nil {
+		return status, err
+	}
+	for _, v := range status.Instances {
+		if !instanceStale(v, status.Now) && v.ChainHeight > status.ChainHeight {
+			status.ChainHeight = v.ChainHeight
+		}
+	}
+	return status, nil
+}
+
+// instance which is killed without removing itself stops heartbeat
+func instanceStale(instance imodel.Instance, now time.Time) bool {
+	return now.Unix()-instance.HeartbeatTime > int64(staleHeartbeats*heartbeatInterval/time.Second)
+}
+
+// print status of cluster
+func WriteClusterStatus(w io.Writer, status ClusterStatus) error {
+	statuses := make([]string, 0, len(status.TaskCounts))
+	for k := range status.TaskCounts {
+		statuses = append(statuses, k)
+	}
+	sort.Strings(statuses)
+	fmt.Fprint(w, "tasks:")
+	for _, v := range statuses {
+		fmt.Fprintf(w, " %v=%v", v, status.TaskCounts[v])
+	}
+	fmt.Fprintln(w)
+
+	if status.CatchUpTotal > 0 {
+		fmt.Fprintf(w, "catch up: %v/%v heights synced (%.2f%%)\n", status.CatchUpSynced, status.CatchUpTotal,
+			float64(status.CatchUpSynced)*100/float64(status.CatchUpTotal))
+	}
+	if status.ChainHeight > 0 {
+		fmt.Fprintf(w, "synced height: %v, chain height: %v, lag: %v blocks\n", status.SyncedHeight,
+			status.ChainHeight, status.ChainHeight-status.SyncedHeight)
+	} else {
+		fmt.Fprintf(w, "synced height: %v, chain height: unknown\n", status.SyncedHeight)
+	}
+	if lease := status.PlannerLease; lease.LeaseExpireTime > status.Now.Unix() {
+		fmt.Fprintf(w, "planner leader: %v, lease expires in %vs\n", lease.InstanceId,
+			lease.LeaseExpireTime-status.Now.Unix())
+	} else {
+		fmt.Fprintln(w, "planner leader: none")
+	}
+
+	fmt.Fprintf(w, "instances: %v\n", len(status.Instances))
+	if len(status.Instances) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tPID\tVERSION\tCONF\tUPTIME\tHEARTBEAT\tWORKERS\tTASKS\tLEADER\tSTATE")
+	for _, v := range status.Instances {
+		state := "alive"
+		if instanceStale(v, status.Now) {
+			state = "stale"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%vs ago\t%v\t%v\t%v\t%v\n", v.ID, v.Pid, v.Version, v.ConfHash,
+			time.Duration(status.Now.Unix()-v.StartTime)*time.Second, status.Now.Unix()-v.HeartbeatTime,
+			v.Workers, v.ActiveTasks, v.PlannerLeader, state)
+	}
+	return tw.Flush()
+}
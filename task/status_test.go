@@ -0,0 +1,46 @@
+package task
+
+import (
+	imodel "github.com/irisnet/rainbow-sync/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteClusterStatus(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	status := ClusterStatus{
+		TaskCounts:    map[string]int{"underway": 2, "completed": 8},
+		CatchUpTotal:  1000,
+		CatchUpSynced: 250,
+		SyncedHeight:  900,
+		ChainHeight:   1000,
+		PlannerLease:  imodel.PlannerLease{InstanceId: "a@1", LeaseExpireTime: now.Unix() + 20},
+		Instances: []imodel.Instance{
+			{ID: "a@1", Version: "v1", StartTime: now.Unix() - 3600, HeartbeatTime: now.Unix() - 5, Workers: 3,
+				ActiveTasks: 2, PlannerLeader: true},
+			{ID: "b@2", Version: "v1", StartTime: now.Unix() - 7200, HeartbeatTime: now.Unix() - 60},
+		},
+		Now: now,
+	}
+	var b strings.Builder
+	if err := WriteClusterStatus(&b, status); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"tasks: completed=8 underway=2",
+		"catch up: 250/1000 heights synced (25.00%)",
+		"lag: 100 blocks",
+		"planner leader: a@1, lease expires in 20s",
+		"instances: 2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("status should contain %q, got:\n%v", want, out)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if !strings.HasSuffix(lines[len(lines)-2], "alive") || !strings.HasSuffix(lines[len(lines)-1], "stale") {
+		t.Errorf("instance without heartbeat for a minute should be stale, got:\n%v", out)
+	}
+}
@@ -16,4 +16,11 @@ const (
 	IbcTransferEventAttriKeyPacketScChannel  = "packet_src_channel"
 	IbcTransferEventAttriKeyPacketDcPort     = "packet_dst_port"
 	IbcTransferEventAttriKeyPacketDcChannels = "packet_dst_channel"
+
+	EventTypeTransfer           = "transfer"
+	EventTypeCoinbase           = "coinbase"
+	EventTypeBurn               = "burn"
+	EventTypeWithdrawRewards    = "withdraw_rewards"
+	EventTypeWithdrawCommission = "withdraw_commission"
+	EventAttrKeyAmount          = "amount"
 )
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"github.com/irisnet/rainbow-sync/lib/logger"
+	"strings"
+)
+
+// kind of sync error, retry decision and metrics are based on kind instead of error text
+type ErrKind string
+
+const (
+	// rpc call to node fails, such as timeout or error response
+	ErrKindRpc ErrKind = "rpc"
+	// height isn't held by any node, dump or archive, retry is useless until it's added
+	ErrKindUnavailable ErrKind = "unavailable"
+	// block or tx result can't be decoded
+	ErrKindDecode ErrKind = "decode"
+	// db operation fails
+	ErrKindDb ErrKind = "db"
+	// txn is applied or removed by other txn runner, docs of txn may have been saved
+	ErrKindTxnConflict ErrKind = "txn_conflict"
+	// error which isn't wrapped as sync error
+	ErrKindUnknown ErrKind = "unknown"
+)
+
+// whether operation failed with error of kind is worth retrying by default
+func (k ErrKind) Retryable() bool {
+	switch k {
+	case ErrKindUnavailable, ErrKindDecode, ErrKindTxnConflict:
+		// docs of conflicted txn may have been saved, caller checks it instead of retrying
+		return false
+	}
+	return true
+}
+
+// SyncError is error of fetching, parsing or saving block, with where and why it happened
+type SyncError struct {
+	Kind      ErrKind
+	Stage     string // operation which fails, such as ParseBlock, TxResult, SaveDocs
+	Height    int64
+	TxHash    string
+	EndPoint  string // address of rpc node if error is from node
+	Retryable bool
+	Err       error
+}
+
+// wrap err as sync error of kind, err which is already sync error keeps its kind and stage,
+// err shouldn't be nil
+func WrapErr(kind ErrKind, stage string, err error) *SyncError {
+	var se *SyncError
+	if errors.As(err, &se) {
+		// copy to keep err unchanged, such as err shared by callers
+		wrapped := *se
+		if wrapped.Stage == "" {
+			wrapped.Stage = stage
+		}
+		return &wrapped
+	}
+	return &SyncError{Kind: kind, Stage: stage, Retryable: kind.Retryable(), Err: err}
+}
+
+// set height if it's unset
+func (e *SyncError) WithHeight(height int64) *SyncError {
+	if e.Height == 0 {
+		e.Height = height
+	}
+	return e
+}
+
+// set tx hash if it's unset
+func (e *SyncError) WithTxHash(txHash string) *SyncError {
+	if e.TxHash == "" {
+		e.TxHash = txHash
+	}
+	return e
+}
+
+// set endpoint if it's unset
+func (e *SyncError) WithEndPoint(endPoint string) *SyncError {
+	if e.EndPoint == "" {
+		e.EndPoint = endPoint
+	}
+	return e
+}
+
+func (e *SyncError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v error", e.Stage, e.Kind)
+	if e.Height > 0 {
+		fmt.Fprintf(&b, ", height: %v", e.Height)
+	}
+	if e.TxHash != "" {
+		fmt.Fprintf(&b, ", tx: %v", e.TxHash)
+	}
+	if e.EndPoint != "" {
+		fmt.Fprintf(&b, ", endpoint: %v", e.EndPoint)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// kind of err, ErrKindUnknown if it isn't sync error
+func ErrKindOf(err error) ErrKind {
+	var se *SyncError
+	if errors.As(err, &se) {
+		return se.Kind
+	}
+	return ErrKindUnknown
+}
+
+// whether operation failed with err is worth retrying, err which isn't sync error is retried
+func IsRetryable(err error) bool {
+	var se *SyncError
+	if errors.As(err, &se) {
+		return se.Retryable
+	}
+	return true
+}
+
+// log fields of err, fields of sync error are logged separately
+func ErrFields(err error) []logger.Field {
+	var se *SyncError
+	if !errors.As(err, &se) {
+		return []logger.Field{logger.String("errKind", string(ErrKindUnknown)), logger.String("err", err.Error())}
+	}
+	fields := []logger.Field{
+		logger.String("errKind", string(se.Kind)),
+		logger.String("errStage", se.Stage),
+		logger.Bool("retryable", se.Retryable),
+		logger.String("err", se.Err.Error()),
+	}
+	if se.TxHash != "" {
+		fields = append(fields, logger.String("txhash", se.TxHash))
+	}
+	if se.EndPoint != "" {
+		fields = append(fields, logger.String("endpoint", se.EndPoint))
+	}
+	return fields
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrapErr(t *testing.T) {
+	errNotFound := errors.New("height not found")
+	inner := WrapErr(ErrKindUnavailable, "dump.Load", errNotFound).WithHeight(10)
+	// rpc error message contains dashes, which broke errTag parsing
+	err := fmt.Errorf("fetch: %w", inner)
+	outer := WrapErr(ErrKindUnknown, "ParseBlock", err).WithHeight(11).WithTxHash("AB-CD")
+
+	if outer.Kind != ErrKindUnavailable || outer.Stage != "dump.Load" || outer.Height != 10 || outer.TxHash != "AB-CD" {
+		t.Fatalf("unexpected wrapped err %+v", outer)
+	}
+	if inner.TxHash != "" {
+		t.Fatal("wrapping shouldn't change inner err")
+	}
+	if !errors.Is(outer, errNotFound) || IsRetryable(outer) || ErrKindOf(err) != ErrKindUnavailable {
+		t.Fatalf("unexpected kind of %v", outer)
+	}
+	if want := "dump.Load unavailable error, height: 10, tx: AB-CD: height not found"; outer.Error() != want {
+		t.Fatalf("got %q, want %q", outer.Error(), want)
+	}
+
+	rpcErr := WrapErr(ErrKindRpc, "rpc.Block", errors.New("post failed: dial tcp - connection refused"))
+	if !IsRetryable(rpcErr) || ErrKindOf(rpcErr) != ErrKindRpc {
+		t.Fatal("rpc err should be retryable")
+	}
+	if plain := errors.New("x"); !IsRetryable(plain) || ErrKindOf(plain) != ErrKindUnknown {
+		t.Fatal("unwrapped err should be unknown and retryable")
+	}
+}